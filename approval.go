@@ -0,0 +1,475 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+const (
+	// ApprovalTool lets approvers confirm statements with the
+	// approve_statement and reject_statement tools from another session of
+	// the SSE server.
+	ApprovalTool = "tool"
+	// ApprovalHTTP lets approvers confirm statements only through the
+	// /approvals endpoints of the SSE server.
+	ApprovalHTTP = "http"
+)
+
+const (
+	ApprovalPending   = "pending"
+	ApprovalExecuting = "executing"
+	ApprovalExecuted  = "executed"
+	ApprovalFailed    = "failed"
+	ApprovalRejected  = "rejected"
+	ApprovalExpired   = "expired"
+)
+
+var (
+	// ApprovalMode is ApprovalTool or ApprovalHTTP when write and DDL tools
+	// need an approver to confirm their statements, empty otherwise.
+	ApprovalMode string
+
+	// ApprovalSecret is the bearer token of the /approvals endpoints and the
+	// secret argument of approve_statement and reject_statement.
+	ApprovalSecret string
+
+	// ApprovalTimeout is how long a statement waits for an approver, and
+	// how long a decided approval is kept for approval_status.
+	ApprovalTimeout time.Duration
+
+	approvals   = map[string]*Approval{}
+	approvalsMu sync.Mutex
+)
+
+// Approval is a statement of a write or DDL tool that waits for an approver.
+type Approval struct {
+	Token   string      `json:"token"`
+	Tool    string      `json:"tool"`
+	Query   string      `json:"query"`
+	Params  interface{} `json:"params,omitempty"`
+	Session string      `json:"session"`
+	Status  string      `json:"status"`
+	// Plan is the EXPLAIN output of the statement, empty for DDL.
+	Plan string `json:"plan,omitempty"`
+	// EstimatedRows is the planner's estimate of the rows the statement
+	// changes, nil for DDL.
+	EstimatedRows *float64 `json:"estimated_rows,omitempty"`
+	Reason        string   `json:"reason,omitempty"`
+	// Result holds the texts of the tool result once the statement ran.
+	Result    []string  `json:"result,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+
+	request mcp.CallToolRequest
+	handler server.ToolHandlerFunc
+	result  *mcp.CallToolResult
+}
+
+// CheckApprovalConfig validates the approval flags. Both modes need the sse
+// transport, over stdio the only session is the one of the agent, and a
+// secret the agent does not know.
+func CheckApprovalConfig() error {
+	switch ApprovalMode {
+	case "":
+		return nil
+	case ApprovalTool, ApprovalHTTP:
+	default:
+		return fmt.Errorf("unknown approval mode %q, expected tool or http", ApprovalMode)
+	}
+
+	if Transport != "sse" {
+		return fmt.Errorf("--approval=%s needs the sse transport, so that the approver can connect separately from the agent", ApprovalMode)
+	}
+	if ApprovalSecret == "" {
+		return fmt.Errorf("--approval=%s needs --approval-secret", ApprovalMode)
+	}
+	if ApprovalTimeout <= 0 {
+		return fmt.Errorf("--approval-timeout must be positive")
+	}
+
+	return nil
+}
+
+// CheckApprovalSecret compares the secret argument of approve_statement and
+// reject_statement with ApprovalSecret.
+func CheckApprovalSecret(secret string) error {
+	if ApprovalSecret == "" || subtle.ConstantTimeCompare([]byte(secret), []byte(ApprovalSecret)) != 1 {
+		return fmt.Errorf("missing or invalid approval secret, denied")
+	}
+
+	return nil
+}
+
+// WithApproval stores the calls of a write or DDL tool as pending approvals
+// instead of running them, when ApprovalMode is set. handler runs once an
+// approver confirms the call. When allowDryRun is set, dry runs of the tool
+// change nothing and run right away.
+func WithApproval(name, expect string, allowDryRun bool, handler server.ToolHandlerFunc) server.ToolHandlerFunc {
+	if ApprovalMode == "" {
+		return handler
+	}
+
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		if dryRun, _ := request.GetArguments()["dry_run"].(bool); dryRun && allowDryRun {
+			return handler(ctx, request)
+		}
+
+		approval, err := RequestApproval(ctx, name, expect, request, handler)
+		if err != nil {
+			return ErrorResult(err), nil
+		}
+
+		return approval.PendingResult()
+	}
+}
+
+// RequestApproval checks the statement of a tool call, previews it and
+// stores it until it is approved, rejected or expires.
+func RequestApproval(ctx context.Context, name, expect string, request mcp.CallToolRequest, handler server.ToolHandlerFunc) (*Approval, error) {
+	query, _ := request.GetArguments()["query"].(string)
+	args, err := ParseParams(request.GetArguments()["params"])
+	if err != nil {
+		return nil, err
+	}
+
+	if err := CheckQuery(ctx, query, expect, args...); err != nil {
+		return nil, err
+	}
+
+	token, err := newApprovalToken()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	approval := &Approval{
+		Token:     token,
+		Tool:      name,
+		Query:     query,
+		Params:    request.GetArguments()["params"],
+		Session:   SessionID(ctx),
+		Status:    ApprovalPending,
+		CreatedAt: now,
+		ExpiresAt: now.Add(ApprovalTimeout),
+		request:   request,
+		handler:   WithToolTimeout(name, handler),
+	}
+
+	if expect != StatementTypeCreate && expect != StatementTypeAlter {
+		plan, err := ExplainQuery(ctx, query, args...)
+		if err != nil {
+			return nil, fmt.Errorf("failed to plan the statement: %v", err)
+		}
+		rows := estimateAffectedRows(plan)
+		approval.Plan, approval.EstimatedRows = plan.Text(), &rows
+	}
+
+	approvalsMu.Lock()
+	approvals[token] = approval
+	approvalsMu.Unlock()
+	log.Printf("approval %s pending for %s: %s", token, name, query)
+
+	return approval.snapshot(), nil
+}
+
+// estimateAffectedRows returns the rows the ModifyTable node at the top of
+// the plan reads from its input. Without RETURNING the node itself is
+// estimated at 0 rows.
+func estimateAffectedRows(plan *PlanNode) float64 {
+	if plan.NodeType != "ModifyTable" {
+		return plan.PlanRows
+	}
+
+	for i := range plan.Plans {
+		if plan.Plans[i].ParentRelationship == "Outer" {
+			return plan.Plans[i].PlanRows
+		}
+	}
+
+	return plan.PlanRows
+}
+
+func newApprovalToken() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to create approval token: %v", err)
+	}
+
+	return hex.EncodeToString(b), nil
+}
+
+// purgeApprovals expires pending approvals past their deadline and drops
+// decided ones that were kept long enough, the caller must hold approvalsMu.
+func purgeApprovals(now time.Time) {
+	for token, approval := range approvals {
+		if now.Before(approval.ExpiresAt) {
+			continue
+		}
+
+		switch approval.Status {
+		case ApprovalPending:
+			approval.Status = ApprovalExpired
+			approval.ExpiresAt = now.Add(ApprovalTimeout)
+		case ApprovalExecuting:
+		default:
+			delete(approvals, token)
+		}
+	}
+}
+
+// GetApproval returns the approval of token.
+func GetApproval(token string) (*Approval, error) {
+	approvalsMu.Lock()
+	defer approvalsMu.Unlock()
+	purgeApprovals(time.Now())
+
+	approval, ok := approvals[token]
+	if !ok {
+		return nil, fmt.Errorf("unknown approval token %q", token)
+	}
+
+	return approval.snapshot(), nil
+}
+
+// PendingApprovals lists the approvals waiting for an approver, oldest
+// first.
+func PendingApprovals() []*Approval {
+	approvalsMu.Lock()
+	defer approvalsMu.Unlock()
+	purgeApprovals(time.Now())
+
+	pending := []*Approval{}
+	for _, approval := range approvals {
+		if approval.Status == ApprovalPending {
+			pending = append(pending, approval.snapshot())
+		}
+	}
+	sort.Slice(pending, func(i, j int) bool {
+		return pending[i].CreatedAt.Before(pending[j].CreatedAt)
+	})
+
+	return pending
+}
+
+// takeApproval moves a pending approval to status, so that it is decided
+// only once. approver is the MCP session deciding it, which must not be the
+// one that requested it, or empty for the /approvals endpoints.
+func takeApproval(token, status, approver string) (*Approval, error) {
+	approvalsMu.Lock()
+	defer approvalsMu.Unlock()
+	now := time.Now()
+	purgeApprovals(now)
+
+	approval, ok := approvals[token]
+	if !ok {
+		return nil, fmt.Errorf("unknown approval token %q", token)
+	}
+	if approval.Status != ApprovalPending {
+		return nil, fmt.Errorf("approval %s is %s, only pending statements can be approved or rejected", token, approval.Status)
+	}
+	if approver != "" && approver == approval.Session {
+		return nil, fmt.Errorf("approval %s was requested by this session, it has to be decided by another one, denied", token)
+	}
+	approval.Status = status
+	approval.ExpiresAt = now.Add(ApprovalTimeout)
+
+	return approval, nil
+}
+
+// ApproveStatement runs the statement of a pending approval with the
+// deadline of its tool and keeps the result for approval_status. approver is
+// the MCP session approving it, empty for the /approvals endpoints.
+func ApproveStatement(ctx context.Context, token, approver string) (*Approval, error) {
+	approval, err := takeApproval(token, ApprovalExecuting, approver)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := approval.handler(ctx, approval.request)
+	if err == nil && result == nil {
+		err = fmt.Errorf("%s returned no result", approval.Tool)
+	}
+	if err != nil {
+		result = ErrorResult(err)
+	}
+
+	approvalsMu.Lock()
+	defer approvalsMu.Unlock()
+	approval.Status = ApprovalExecuted
+	if result.IsError {
+		approval.Status = ApprovalFailed
+	}
+	approval.result = result
+	approval.Result = nil
+	for _, content := range result.Content {
+		if text, ok := content.(mcp.TextContent); ok {
+			approval.Result = append(approval.Result, text.Text)
+		}
+	}
+	approval.ExpiresAt = time.Now().Add(ApprovalTimeout)
+	log.Printf("approval %s %s", token, approval.Status)
+
+	return approval.snapshot(), nil
+}
+
+// RejectStatement discards the statement of a pending approval, approver is
+// as for ApproveStatement.
+func RejectStatement(token, reason, approver string) (*Approval, error) {
+	approval, err := takeApproval(token, ApprovalRejected, approver)
+	if err != nil {
+		return nil, err
+	}
+
+	approvalsMu.Lock()
+	defer approvalsMu.Unlock()
+	approval.Reason = reason
+	log.Printf("approval %s rejected", token)
+
+	return approval.snapshot(), nil
+}
+
+// snapshot copies the approval for use outside of approvalsMu.
+func (a *Approval) snapshot() *Approval {
+	c := *a
+	c.Result = append([]string(nil), a.Result...)
+
+	return &c
+}
+
+// Preview describes what the statement is going to do.
+func (a *Approval) Preview() string {
+	if a.EstimatedRows == nil {
+		return "preview: DDL statements have no query plan"
+	}
+
+	return fmt.Sprintf("preview: an estimated %.0f rows affected\n%s", *a.EstimatedRows, a.Plan)
+}
+
+// PendingResult tells the caller that the statement waits for an approver,
+// followed by the preview and the approval as JSON.
+func (a *Approval) PendingResult() (*mcp.CallToolResult, error) {
+	how := "an approver calls approve_statement with this token from another session"
+	if ApprovalMode == ApprovalHTTP {
+		how = fmt.Sprintf("an approver confirms it with POST /approvals/%s/approve", a.Token)
+	}
+	text := fmt.Sprintf("approval required, nothing was executed yet. The statement is pending as token %s until %s, or until it expires at %s. Call approval_status with the token to get the result",
+		a.Token, how, a.ExpiresAt.Format(time.RFC3339))
+
+	data, err := json.Marshal(a)
+	if err != nil {
+		return nil, err
+	}
+
+	return &mcp.CallToolResult{Content: []mcp.Content{
+		mcp.NewTextContent(text),
+		mcp.NewTextContent(a.Preview()),
+		mcp.NewTextContent(string(data)),
+	}}, nil
+}
+
+// StatusResult reports the status of the approval. Once the statement ran,
+// its tool result follows the status line.
+func (a *Approval) StatusResult() (*mcp.CallToolResult, error) {
+	text := fmt.Sprintf("approval %s of %s is %s", a.Token, a.Tool, a.Status)
+	if a.Reason != "" {
+		text += ": " + a.Reason
+	}
+
+	if a.result != nil {
+		return &mcp.CallToolResult{
+			Content: append([]mcp.Content{mcp.NewTextContent(text)}, a.result.Content...),
+			IsError: a.result.IsError,
+		}, nil
+	}
+
+	data, err := json.Marshal(a)
+	if err != nil {
+		return nil, err
+	}
+
+	return &mcp.CallToolResult{Content: []mcp.Content{
+		mcp.NewTextContent(text),
+		mcp.NewTextContent(string(data)),
+	}}, nil
+}
+
+// ApprovalHandler serves the /approvals endpoints for approvers:
+//
+//	GET  /approvals                 pending approvals, oldest first
+//	GET  /approvals/{token}         a single approval
+//	POST /approvals/{token}/approve run the statement
+//	POST /approvals/{token}/reject  discard it, with an optional reason form value
+//
+// Every request needs an `Authorization: Bearer <ApprovalSecret>` header.
+func ApprovalHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /approvals", func(w http.ResponseWriter, r *http.Request) {
+		writeApprovalJSON(w, http.StatusOK, PendingApprovals())
+	})
+	mux.HandleFunc("GET /approvals/{token}", func(w http.ResponseWriter, r *http.Request) {
+		approval, err := GetApproval(r.PathValue("token"))
+		if err != nil {
+			writeApprovalError(w, http.StatusNotFound, err)
+			return
+		}
+		writeApprovalJSON(w, http.StatusOK, approval)
+	})
+	mux.HandleFunc("POST /approvals/{token}/approve", func(w http.ResponseWriter, r *http.Request) {
+		if _, err := GetApproval(r.PathValue("token")); err != nil {
+			writeApprovalError(w, http.StatusNotFound, err)
+			return
+		}
+
+		approval, err := ApproveStatement(r.Context(), r.PathValue("token"), "")
+		if err != nil {
+			writeApprovalError(w, http.StatusConflict, err)
+			return
+		}
+		writeApprovalJSON(w, http.StatusOK, approval)
+	})
+	mux.HandleFunc("POST /approvals/{token}/reject", func(w http.ResponseWriter, r *http.Request) {
+		if _, err := GetApproval(r.PathValue("token")); err != nil {
+			writeApprovalError(w, http.StatusNotFound, err)
+			return
+		}
+
+		approval, err := RejectStatement(r.PathValue("token"), r.FormValue("reason"), "")
+		if err != nil {
+			writeApprovalError(w, http.StatusConflict, err)
+			return
+		}
+		writeApprovalJSON(w, http.StatusOK, approval)
+	})
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth := []byte(r.Header.Get("Authorization"))
+		if ApprovalSecret == "" || subtle.ConstantTimeCompare(auth, []byte("Bearer "+ApprovalSecret)) != 1 {
+			writeApprovalError(w, http.StatusUnauthorized, fmt.Errorf("missing or invalid approval secret"))
+			return
+		}
+
+		mux.ServeHTTP(w, r)
+	})
+}
+
+func writeApprovalJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeApprovalError(w http.ResponseWriter, status int, err error) {
+	writeApprovalJSON(w, status, map[string]string{"error": err.Error()})
+}
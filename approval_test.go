@@ -0,0 +1,337 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+	"github.com/stretchr/testify/assert"
+)
+
+const updatePlanJSON = `[{"Plan": {"Node Type": "ModifyTable", "Operation": "Update", "Relation Name": "users", "Schema": "public", "Startup Cost": 0.00, "Total Cost": 35.50, "Plan Rows": 0, "Plan Width": 0,
+  "Plans": [{"Node Type": "Seq Scan", "Parent Relationship": "Outer", "Relation Name": "users", "Schema": "public", "Startup Cost": 0.00, "Total Cost": 35.50, "Plan Rows": 42, "Plan Width": 10}]}}]`
+
+// setupApprovals enables the approval mode until the returned function is
+// called.
+func setupApprovals(mode string) func() {
+	originalMode, originalSecret, originalTimeout := ApprovalMode, ApprovalSecret, ApprovalTimeout
+	ApprovalMode, ApprovalSecret, ApprovalTimeout = mode, "s3cret", time.Hour
+
+	return func() {
+		ApprovalMode, ApprovalSecret, ApprovalTimeout = originalMode, originalSecret, originalTimeout
+		approvalsMu.Lock()
+		approvals = map[string]*Approval{}
+		approvalsMu.Unlock()
+	}
+}
+
+// testSession is an MCP session of the SSE transport.
+type testSession struct {
+	id string
+}
+
+func (s testSession) Initialize()                                         {}
+func (s testSession) Initialized() bool                                   { return true }
+func (s testSession) NotificationChannel() chan<- mcp.JSONRPCNotification { return nil }
+func (s testSession) SessionID() string                                   { return s.id }
+
+// sessionContext returns a context of the session with the given ID.
+func sessionContext(id string) context.Context {
+	return server.NewMCPServer("test", "0").WithContext(context.Background(), testSession{id: id})
+}
+
+func toolCall(arguments map[string]interface{}) mcp.CallToolRequest {
+	call := mcp.CallToolRequest{}
+	call.Params.Arguments = arguments
+
+	return call
+}
+
+func TestCheckApprovalConfig(t *testing.T) {
+	defer setupApprovals("")()
+	originalTransport := Transport
+	defer func() { Transport = originalTransport }()
+
+	Transport = "sse"
+	for _, mode := range []string{"", ApprovalTool, ApprovalHTTP} {
+		ApprovalMode = mode
+		assert.NoError(t, CheckApprovalConfig(), mode)
+	}
+
+	ApprovalMode = "always"
+	assert.Error(t, CheckApprovalConfig())
+
+	for _, mode := range []string{ApprovalTool, ApprovalHTTP} {
+		ApprovalMode, ApprovalSecret, Transport = mode, "", "sse"
+		assert.ErrorContains(t, CheckApprovalConfig(), "--approval-secret", mode)
+
+		ApprovalSecret, Transport = "s3cret", "stdio"
+		assert.ErrorContains(t, CheckApprovalConfig(), "sse transport", mode)
+	}
+
+	Transport = "sse"
+
+	ApprovalMode, ApprovalTimeout = ApprovalTool, 0
+	assert.ErrorContains(t, CheckApprovalConfig(), "--approval-timeout")
+
+	assert.NoError(t, CheckApprovalSecret("s3cret"))
+	assert.Error(t, CheckApprovalSecret("s3cre"))
+	assert.Error(t, CheckApprovalSecret(""))
+}
+
+func TestWithApproval(t *testing.T) {
+	_, mock, cleanup := setupMockDB(t)
+	defer cleanup()
+	defer setupApprovals(ApprovalTool)()
+
+	calls := 0
+	handler := WithApproval("update_query", StatementTypeUpdate, true, func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		calls++
+		return mcp.NewToolResultText("42 rows affected"), nil
+	})
+
+	var token string
+	t.Run("stores the statement", func(t *testing.T) {
+		// Setup mock expectations
+		expectTx(mock)
+		mock.ExpectQuery(`EXPLAIN \(FORMAT JSON, VERBOSE\) UPDATE users`).WithArgs(true).
+			WillReturnRows(sqlmock.NewRows([]string{"QUERY PLAN"}).AddRow([]byte(updatePlanJSON)))
+		mock.ExpectRollback()
+
+		// Call the wrapped handler
+		result, err := handler(sessionContext("agent"), toolCall(map[string]interface{}{
+			"query":  "UPDATE users SET active = $1 WHERE last_login < now() - interval '1 year'",
+			"params": []interface{}{true},
+		}))
+
+		// Verify results
+		assert.NoError(t, err)
+		assert.False(t, result.IsError)
+		assert.Equal(t, 0, calls)
+		assert.Len(t, result.Content, 3)
+		assert.Contains(t, result.Content[0].(mcp.TextContent).Text, "approval required, nothing was executed yet")
+		assert.Equal(t, "preview: an estimated 42 rows affected\nUpdate on public.users  (cost=0.00..35.50 rows=0)\n  ->  Seq Scan on public.users  (cost=0.00..35.50 rows=42)", result.Content[1].(mcp.TextContent).Text)
+		assert.NoError(t, mock.ExpectationsWereMet())
+
+		var approval Approval
+		assert.NoError(t, json.Unmarshal([]byte(result.Content[2].(mcp.TextContent).Text), &approval))
+		assert.Equal(t, ApprovalPending, approval.Status)
+		assert.Equal(t, "update_query", approval.Tool)
+		assert.Equal(t, 42.0, *approval.EstimatedRows)
+		assert.Equal(t, "agent", approval.Session)
+		assert.Len(t, approval.Token, 32)
+		token = approval.Token
+	})
+
+	t.Run("the requesting session cannot decide", func(t *testing.T) {
+		// Call ApproveStatement and RejectStatement from the agent session
+		_, approveErr := ApproveStatement(sessionContext("agent"), token, "agent")
+		_, rejectErr := RejectStatement(token, "", "agent")
+
+		// Verify results
+		assert.ErrorContains(t, approveErr, "has to be decided by another one")
+		assert.ErrorContains(t, rejectErr, "has to be decided by another one")
+		assert.Equal(t, 0, calls)
+		approval, err := GetApproval(token)
+		assert.NoError(t, err)
+		assert.Equal(t, ApprovalPending, approval.Status)
+	})
+
+	t.Run("approve runs the statement once", func(t *testing.T) {
+		// Call ApproveStatement
+		approval, err := ApproveStatement(sessionContext("approver"), token, "approver")
+
+		// Verify results
+		assert.NoError(t, err)
+		assert.Equal(t, 1, calls)
+		assert.Equal(t, ApprovalExecuted, approval.Status)
+		assert.Equal(t, []string{"42 rows affected"}, approval.Result)
+
+		status, err := GetApproval(token)
+		assert.NoError(t, err)
+		result, err := status.StatusResult()
+		assert.NoError(t, err)
+		assert.Equal(t, "approval "+token+" of update_query is executed", result.Content[0].(mcp.TextContent).Text)
+		assert.Equal(t, "42 rows affected", result.Content[1].(mcp.TextContent).Text)
+
+		_, err = ApproveStatement(sessionContext("approver"), token, "approver")
+		assert.ErrorContains(t, err, "is executed")
+		assert.Equal(t, 1, calls)
+	})
+
+	t.Run("denied statements are not stored", func(t *testing.T) {
+		// Call the wrapped handler
+		result, err := handler(context.Background(), toolCall(map[string]interface{}{"query": "UPDATE users SET active = false"}))
+
+		// Verify results
+		assert.NoError(t, err)
+		assert.True(t, result.IsError)
+		assert.Contains(t, result.Content[0].(mcp.TextContent).Text, "without a WHERE clause")
+		assert.Empty(t, PendingApprovals())
+	})
+
+	t.Run("dry runs are not held back", func(t *testing.T) {
+		// Call the wrapped handler
+		_, err := handler(context.Background(), toolCall(map[string]interface{}{"query": "UPDATE users SET active = false WHERE id = 1", "dry_run": true}))
+
+		// Verify results
+		assert.NoError(t, err)
+		assert.Equal(t, 2, calls)
+	})
+
+	t.Run("DDL, rejection and expiry", func(t *testing.T) {
+		ddl := WithApproval("create_table", StatementTypeCreate, false, func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			calls++
+			return mcp.NewToolResultText("0 rows affected"), nil
+		})
+
+		// Call the wrapped handler twice, DDL is not planned
+		var tokens []string
+		for i := 0; i < 2; i++ {
+			result, err := ddl(context.Background(), toolCall(map[string]interface{}{"query": "CREATE TABLE t (id int)"}))
+			assert.NoError(t, err)
+			assert.Equal(t, "preview: DDL statements have no query plan", result.Content[1].(mcp.TextContent).Text)
+
+			var approval Approval
+			assert.NoError(t, json.Unmarshal([]byte(result.Content[2].(mcp.TextContent).Text), &approval))
+			tokens = append(tokens, approval.Token)
+		}
+		assert.Len(t, PendingApprovals(), 2)
+
+		// Verify rejection
+		approval, err := RejectStatement(tokens[0], "use a migration", "approver")
+		assert.NoError(t, err)
+		assert.Equal(t, ApprovalRejected, approval.Status)
+		assert.Equal(t, "use a migration", approval.Reason)
+
+		// Verify expiry
+		approvalsMu.Lock()
+		approvals[tokens[1]].ExpiresAt = time.Now().Add(-time.Second)
+		approvalsMu.Unlock()
+		approval, err = GetApproval(tokens[1])
+		assert.NoError(t, err)
+		assert.Equal(t, ApprovalExpired, approval.Status)
+
+		_, err = ApproveStatement(context.Background(), tokens[1], "")
+		assert.ErrorContains(t, err, "is expired")
+		assert.Equal(t, 2, calls)
+		assert.Empty(t, PendingApprovals())
+
+		_, err = GetApproval("unknown")
+		assert.ErrorContains(t, err, "unknown approval token")
+	})
+
+	t.Run("handler without a result", func(t *testing.T) {
+		empty := WithApproval("create_table", StatementTypeCreate, false, func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			return nil, nil
+		})
+		_, err := empty(context.Background(), toolCall(map[string]interface{}{"query": "CREATE TABLE t (id int)"}))
+		assert.NoError(t, err)
+		token := PendingApprovals()[0].Token
+
+		// Call ApproveStatement
+		approval, err := ApproveStatement(context.Background(), token, "")
+
+		// Verify results
+		assert.NoError(t, err)
+		assert.Equal(t, ApprovalFailed, approval.Status)
+		assert.Contains(t, approval.Result[0], "create_table returned no result")
+	})
+
+	t.Run("dry runs of tools without a dry run are held back", func(t *testing.T) {
+		write := WithApproval("write_query", StatementTypeInsert, false, func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			calls++
+			return mcp.NewToolResultText("1 rows affected"), nil
+		})
+		ddl := WithApproval("create_table", StatementTypeCreate, false, func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			calls++
+			return mcp.NewToolResultText("0 rows affected"), nil
+		})
+
+		// Setup mock expectations
+		expectTx(mock)
+		mock.ExpectQuery(`EXPLAIN \(FORMAT JSON, VERBOSE\) INSERT INTO users`).
+			WillReturnRows(sqlmock.NewRows([]string{"QUERY PLAN"}).AddRow([]byte(updatePlanJSON)))
+		mock.ExpectRollback()
+
+		// Call the wrapped handlers with dry_run set
+		for _, call := range []struct {
+			handler server.ToolHandlerFunc
+			query   string
+		}{
+			{write, "INSERT INTO users (name) VALUES ('bob')"},
+			{ddl, "CREATE TABLE t (id int)"},
+		} {
+			result, err := call.handler(context.Background(), toolCall(map[string]interface{}{"query": call.query, "dry_run": true}))
+
+			// Verify results
+			assert.NoError(t, err)
+			assert.False(t, result.IsError)
+			assert.Contains(t, result.Content[0].(mcp.TextContent).Text, "approval required, nothing was executed yet")
+		}
+		assert.Equal(t, 2, calls)
+		assert.Len(t, PendingApprovals(), 2)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
+
+func TestApprovalHandler(t *testing.T) {
+	defer setupApprovals(ApprovalHTTP)()
+
+	calls := 0
+	handler := WithApproval("alter_table", StatementTypeAlter, false, func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		calls++
+		return mcp.NewToolResultText("0 rows affected"), nil
+	})
+	result, err := handler(context.Background(), toolCall(map[string]interface{}{"query": "ALTER TABLE t ADD COLUMN name text"}))
+	assert.NoError(t, err)
+	assert.Contains(t, result.Content[0].(mcp.TextContent).Text, "POST /approvals/")
+	token := PendingApprovals()[0].Token
+
+	serve := func(method, path, secret string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, path, strings.NewReader("reason=later"))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		if secret != "" {
+			r.Header.Set("Authorization", "Bearer "+secret)
+		}
+		w := httptest.NewRecorder()
+		ApprovalHandler().ServeHTTP(w, r)
+		return w
+	}
+
+	t.Run("requires the secret", func(t *testing.T) {
+		assert.Equal(t, http.StatusUnauthorized, serve("GET", "/approvals", "").Code)
+		assert.Equal(t, http.StatusUnauthorized, serve("POST", "/approvals/"+token+"/approve", "wrong").Code)
+		assert.Equal(t, 0, calls)
+	})
+
+	t.Run("lists pending approvals", func(t *testing.T) {
+		w := serve("GET", "/approvals", "s3cret")
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		var pending []Approval
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &pending))
+		assert.Len(t, pending, 1)
+		assert.Equal(t, "ALTER TABLE t ADD COLUMN name text", pending[0].Query)
+	})
+
+	t.Run("approves once", func(t *testing.T) {
+		w := serve("POST", "/approvals/"+token+"/approve", "s3cret")
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		var approval Approval
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &approval))
+		assert.Equal(t, ApprovalExecuted, approval.Status)
+		assert.Equal(t, 1, calls)
+
+		assert.Equal(t, http.StatusConflict, serve("POST", "/approvals/"+token+"/reject", "s3cret").Code)
+		assert.Equal(t, http.StatusNotFound, serve("POST", "/approvals/unknown/approve", "s3cret").Code)
+	})
+}
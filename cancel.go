@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// MethodCancelled is the notification a client sends to cancel one of its
+// running requests.
+const MethodCancelled = "notifications/cancelled"
+
+// callKey identifies a running tool call by its session and JSON-RPC id.
+type callKey struct {
+	session string
+	id      string
+}
+
+var (
+	callsMu sync.Mutex
+	// callIDs maps the context of a tool call to its request id, tool
+	// handlers only get the context.
+	callIDs = map[context.Context]string{}
+	// callCancels holds the cancel functions of the running tool calls.
+	callCancels = map[callKey]context.CancelFunc{}
+)
+
+// requestID encodes a JSON-RPC id as JSON, so that a number read as float64
+// and the id of a request compare equal.
+func requestID(id any) string {
+	data, err := json.Marshal(id)
+	if err != nil {
+		return ""
+	}
+
+	return string(data)
+}
+
+// AddCancelHooks records the request ids of tool calls, so that
+// WithCancel can register them for HandleCancelled.
+func AddCancelHooks(hooks *server.Hooks) {
+	hooks.AddBeforeCallTool(func(ctx context.Context, id any, request *mcp.CallToolRequest) {
+		callsMu.Lock()
+		defer callsMu.Unlock()
+
+		callIDs[ctx] = requestID(id)
+	})
+	// the id is left behind when no handler took it, e.g. for unknown tools
+	hooks.AddAfterCallTool(func(ctx context.Context, id any, request *mcp.CallToolRequest, result *mcp.CallToolResult) {
+		forgetCall(ctx)
+	})
+	hooks.AddOnError(func(ctx context.Context, id any, method mcp.MCPMethod, message any, err error) {
+		forgetCall(ctx)
+	})
+}
+
+func forgetCall(ctx context.Context) {
+	callsMu.Lock()
+	defer callsMu.Unlock()
+
+	delete(callIDs, ctx)
+}
+
+// WithCancel returns a context that HandleCancelled cancels when the client
+// cancels the tool call of ctx. done has to be called once the call returns.
+func WithCancel(ctx context.Context) (context.Context, func()) {
+	callsMu.Lock()
+	defer callsMu.Unlock()
+
+	id, ok := callIDs[ctx]
+	if !ok {
+		return ctx, func() {}
+	}
+	delete(callIDs, ctx)
+
+	key := callKey{session: SessionID(ctx), id: id}
+	ctx, cancel := context.WithCancel(ctx)
+	callCancels[key] = cancel
+
+	return ctx, func() {
+		callsMu.Lock()
+		defer callsMu.Unlock()
+
+		delete(callCancels, key)
+		cancel()
+	}
+}
+
+// HandleCancelled cancels the context of the tool call named by a
+// notifications/cancelled notification. pgx then cancels its running
+// statement on the server. Unknown and finished requests are ignored.
+func HandleCancelled(ctx context.Context, notification mcp.JSONRPCNotification) {
+	id, ok := notification.Params.AdditionalFields["requestId"]
+	if !ok {
+		return
+	}
+
+	callsMu.Lock()
+	defer callsMu.Unlock()
+
+	if cancel, ok := callCancels[callKey{session: SessionID(ctx), id: requestID(id)}]; ok {
+		cancel()
+	}
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHandleCancelled(t *testing.T) {
+	hooks := &server.Hooks{}
+	AddCancelHooks(hooks)
+	s := server.NewMCPServer("test", "0.0.0", server.WithHooks(hooks))
+	s.AddNotificationHandler(MethodCancelled, HandleCancelled)
+
+	started := make(chan struct{})
+	s.AddTool(mcp.NewTool("read_query"), WithToolTimeout("read_query", func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		close(started)
+		<-ctx.Done()
+		return ErrorResult(ctx.Err()), nil
+	}))
+
+	t.Run("cancels the running call", func(t *testing.T) {
+		// Call the tool
+		response := make(chan mcp.JSONRPCMessage)
+		go func() {
+			response <- s.HandleMessage(context.Background(), []byte(`{"jsonrpc": "2.0", "id": 7, "method": "tools/call", "params": {"name": "read_query"}}`))
+		}()
+		<-started
+
+		// Cancel another request, then the call
+		s.HandleMessage(context.Background(), []byte(`{"jsonrpc": "2.0", "method": "notifications/cancelled", "params": {"requestId": 8}}`))
+		select {
+		case <-response:
+			t.Fatal("the call was canceled by the id of another request")
+		case <-time.After(20 * time.Millisecond):
+		}
+		s.HandleMessage(context.Background(), []byte(`{"jsonrpc": "2.0", "method": "notifications/cancelled", "params": {"requestId": 7, "reason": "user abort"}}`))
+
+		// Verify results
+		select {
+		case message := <-response:
+			result := message.(mcp.JSONRPCResponse).Result.(mcp.CallToolResult)
+			assert.True(t, result.IsError)
+			assert.Contains(t, result.Content[0].(mcp.TextContent).Text, "context canceled")
+		case <-time.After(time.Second):
+			t.Fatal("the call was not canceled")
+		}
+
+		callsMu.Lock()
+		defer callsMu.Unlock()
+		assert.Empty(t, callIDs)
+		assert.Empty(t, callCancels)
+	})
+
+	t.Run("unknown tools leave nothing behind", func(t *testing.T) {
+		// Call an unknown tool
+		s.HandleMessage(context.Background(), []byte(`{"jsonrpc": "2.0", "id": "a", "method": "tools/call", "params": {"name": "unknown"}}`))
+
+		// Verify results
+		callsMu.Lock()
+		defer callsMu.Unlock()
+		assert.Empty(t, callIDs)
+	})
+}
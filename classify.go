@@ -0,0 +1,709 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+type tokenKind int
+
+const (
+	tokenWord tokenKind = iota
+	tokenQuotedIdent
+	tokenString
+	tokenNumber
+	tokenParam
+	tokenPunct
+)
+
+type token struct {
+	kind  tokenKind
+	text  string // upper-cased for words
+	start int
+	end   int
+}
+
+func (t token) is(kind tokenKind, text string) bool {
+	return t.kind == kind && t.text == text
+}
+
+func (t token) isWord(words ...string) bool {
+	if t.kind != tokenWord {
+		return false
+	}
+	for _, w := range words {
+		if t.text == w {
+			return true
+		}
+	}
+	return false
+}
+
+// Statement is the classification of a single SQL statement.
+type Statement struct {
+	Text string
+	// Command is the leading command keyword once WITH and EXPLAIN ANALYZE
+	// are unwrapped, e.g. SELECT, INSERT, COPY or DO.
+	Command string
+	// Modifying lists the commands of data-modifying statements in WITH.
+	Modifying []string
+	// Into is set for `SELECT ... INTO`, which creates a table.
+	Into bool
+	// Locking is set for `SELECT ... FOR UPDATE/SHARE`.
+	Locking bool
+	// Returning is set for INSERT, UPDATE, DELETE and MERGE statements with
+	// a RETURNING clause, which return the rows they changed.
+	Returning bool
+	// Unfiltered lists the UPDATE and DELETE commands, including those in
+	// WITH, that have no WHERE clause, or one that does not depend on the
+	// row like `WHERE 1 = 1`, and so change every row of the table.
+	Unfiltered []string
+	// SideEffects lists called functions that change state.
+	SideEffects []string
+}
+
+// readCommands are the commands that only read data.
+var readCommands = map[string]bool{
+	"SELECT":  true,
+	"VALUES":  true,
+	"TABLE":   true,
+	"SHOW":    true,
+	"EXPLAIN": true,
+}
+
+// sideEffectFunctions are functions that modify data, sessions or the server,
+// and so must not be reachable from a read-only query.
+var sideEffectFunctions = map[string]bool{
+	"nextval":                             true,
+	"setval":                              true,
+	"set_config":                          true,
+	"pg_notify":                           true,
+	"pg_sleep":                            true,
+	"pg_sleep_for":                        true,
+	"pg_sleep_until":                      true,
+	"pg_advisory_lock":                    true,
+	"pg_advisory_lock_shared":             true,
+	"pg_advisory_xact_lock":               true,
+	"pg_try_advisory_lock":                true,
+	"pg_try_advisory_xact_lock":           true,
+	"pg_cancel_backend":                   true,
+	"pg_terminate_backend":                true,
+	"pg_reload_conf":                      true,
+	"pg_rotate_logfile":                   true,
+	"pg_promote":                          true,
+	"pg_switch_wal":                       true,
+	"pg_create_restore_point":             true,
+	"pg_create_physical_replication_slot": true,
+	"pg_create_logical_replication_slot":  true,
+	"pg_drop_replication_slot":            true,
+	"pg_read_file":                        true,
+	"pg_read_binary_file":                 true,
+	"pg_ls_dir":                           true,
+	"pg_stat_reset":                       true,
+	"lo_import":                           true,
+	"lo_export":                           true,
+	"lo_create":                           true,
+	"lo_unlink":                           true,
+	"lo_put":                              true,
+	"lo_from_bytea":                       true,
+	"dblink":                              true,
+	"dblink_exec":                         true,
+	"dblink_connect":                      true,
+	"query_to_xml":                        true,
+	"query_to_xml_and_xmlschema":          true,
+}
+
+// Type maps the statement to a StatementType* constant when it matches one,
+// or returns its command otherwise.
+func (s *Statement) Type() string {
+	switch {
+	case s.Into:
+		return "SELECT INTO"
+	case readCommands[s.Command]:
+		return StatementTypeSelect
+	default:
+		return s.Command
+	}
+}
+
+// Check verifies that the statement does only what the tool expects.
+func (s *Statement) Check(expect string) error {
+	got := s.Type()
+
+	match := got == expect
+	switch expect {
+	case StatementTypeCreate:
+		match = match || got == "COMMENT" || got == "SELECT INTO"
+	case StatementTypeAlter:
+		match = match || got == "COMMENT"
+	}
+	if !match {
+		return fmt.Errorf("statement classified as %s does not match the expected %s, denied", got, expect)
+	}
+
+	for _, command := range s.Modifying {
+		if command != expect {
+			return fmt.Errorf("statement contains a data-modifying %s in its WITH clause, expected %s, denied", command, expect)
+		}
+		if MaxAffectedRows > 0 && (command == StatementTypeUpdate || command == StatementTypeDelete) {
+			return fmt.Errorf("the rows changed by a data-modifying %s in a WITH clause are not counted against --max-affected-rows, run it as a separate statement, denied", command)
+		}
+	}
+
+	if len(s.Unfiltered) > 0 && !AllowUnfilteredWrites {
+		return fmt.Errorf("%s without a WHERE clause, or with one that does not depend on the row, would change every row of the table, add a WHERE condition, denied", s.Unfiltered[0])
+	}
+
+	if expect == StatementTypeSelect {
+		if s.Locking {
+			return fmt.Errorf("SELECT ... FOR UPDATE/SHARE takes row locks, denied")
+		}
+		if len(s.SideEffects) > 0 {
+			return fmt.Errorf("statement calls %s() which has side effects, denied", s.SideEffects[0])
+		}
+	}
+
+	return nil
+}
+
+// CheckStatementType classifies every statement in query and rejects anything
+// that does not match the statement type the tool expects. Only DDL tools may
+// run more than one statement at once.
+func CheckStatementType(query, expect string) error {
+	stmts, err := ClassifyStatements(query)
+	if err != nil {
+		return fmt.Errorf("unable to parse query: %v, denied", err)
+	}
+
+	if len(stmts) == 0 {
+		return fmt.Errorf("empty query, denied")
+	}
+
+	if len(stmts) > 1 && expect != StatementTypeCreate && expect != StatementTypeAlter {
+		return fmt.Errorf("multiple statements are not allowed, found %d, denied", len(stmts))
+	}
+
+	for _, stmt := range stmts {
+		if err := stmt.Check(expect); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ClassifyStatements splits query into statements and classifies each one.
+func ClassifyStatements(query string) ([]*Statement, error) {
+	tokens, err := tokenize(query)
+	if err != nil {
+		return nil, err
+	}
+
+	stmts := []*Statement{}
+	for _, part := range splitStatements(tokens) {
+		stmt := &Statement{Text: strings.TrimSpace(query[part[0].start:part[len(part)-1].end])}
+		classifyTokens(stmt, part)
+		stmts = append(stmts, stmt)
+	}
+
+	return stmts, nil
+}
+
+// splitStatements splits tokens on top level semicolons. Semicolons inside a
+// `BEGIN ATOMIC ... END` function body do not end the statement.
+func splitStatements(tokens []token) [][]token {
+	parts := [][]token{}
+	depth, atomic := 0, 0
+	start := 0
+	for i, tok := range tokens {
+		switch {
+		case tok.is(tokenPunct, "("):
+			depth++
+		case tok.is(tokenPunct, ")"):
+			depth--
+		case tok.isWord("ATOMIC") && i > 0 && tokens[i-1].isWord("BEGIN"):
+			atomic++
+		case tok.isWord("END") && atomic > 0:
+			atomic--
+		case tok.is(tokenPunct, ";") && depth <= 0 && atomic == 0:
+			if i > start {
+				parts = append(parts, tokens[start:i])
+			}
+			start = i + 1
+		}
+	}
+	if start < len(tokens) {
+		parts = append(parts, tokens[start:])
+	}
+
+	return parts
+}
+
+func classifyTokens(stmt *Statement, tokens []token) {
+	// (SELECT ...) UNION (SELECT ...)
+	for len(tokens) > 0 && tokens[0].is(tokenPunct, "(") {
+		tokens = tokens[1:]
+	}
+	if len(tokens) == 0 {
+		return
+	}
+
+	for i := 0; i+1 < len(tokens); i++ {
+		// "pg_terminate_backend"(...) calls the function as well, unlike
+		// "NextVal"(...), as quoted identifiers keep their case
+		ident := tokens[i].kind == tokenWord || tokens[i].kind == tokenQuotedIdent
+		if ident && tokens[i+1].is(tokenPunct, "(") {
+			name := tokens[i].text
+			if tokens[i].kind == tokenWord {
+				name = strings.ToLower(name)
+			}
+			if sideEffectFunctions[name] {
+				stmt.SideEffects = append(stmt.SideEffects, name)
+			}
+		}
+	}
+
+	stmt.Command = tokens[0].text
+	switch stmt.Command {
+	case "WITH":
+		classifyWith(stmt, tokens[1:])
+	case "EXPLAIN":
+		classifyExplain(stmt, tokens[1:])
+	case "SELECT":
+		classifySelect(stmt, tokens)
+	case "INSERT", "MERGE":
+		classifyReturning(stmt, tokens)
+	case "UPDATE", "DELETE":
+		classifyReturning(stmt, tokens)
+		classifyWhere(stmt, tokens)
+	}
+}
+
+func classifySelect(stmt *Statement, tokens []token) {
+	depth := 0
+	for i, tok := range tokens {
+		switch {
+		case tok.is(tokenPunct, "("):
+			depth++
+		case tok.is(tokenPunct, ")"):
+			depth--
+		case tok.isWord("INTO") && depth == 0:
+			stmt.Into = true
+		case tok.isWord("FOR") && i+1 < len(tokens) && tokens[i+1].isWord("UPDATE", "SHARE", "NO", "KEY"):
+			stmt.Locking = true
+		}
+	}
+}
+
+// classifyReturning looks for a top level RETURNING clause, a RETURNING in
+// a parenthesized subquery belongs to a CTE.
+func classifyReturning(stmt *Statement, tokens []token) {
+	depth := 0
+	for _, tok := range tokens {
+		switch {
+		case tok.is(tokenPunct, "("):
+			depth++
+		case tok.is(tokenPunct, ")"):
+			depth--
+		case tok.isWord("RETURNING") && depth == 0:
+			stmt.Returning = true
+		}
+	}
+}
+
+// classifyWhere looks for a top level WHERE clause, including WHERE CURRENT
+// OF. A WHERE in a subquery of SET, FROM or USING does not filter the target
+// table, neither does a condition that is true or false for every row, like
+// `WHERE true` or `WHERE id = 1 OR 1 = 1`.
+func classifyWhere(stmt *Statement, tokens []token) {
+	depth := 0
+	for i, tok := range tokens {
+		switch {
+		case tok.is(tokenPunct, "("):
+			depth++
+		case tok.is(tokenPunct, ")"):
+			depth--
+		case tok.isWord("WHERE") && depth == 0:
+			if filtersRows(tokens[i+1:]) {
+				return
+			}
+		}
+	}
+
+	stmt.Unfiltered = append(stmt.Unfiltered, stmt.Command)
+}
+
+// constantWords are the keywords that may appear in a condition without
+// making it depend on the row.
+var constantWords = map[string]bool{
+	"TRUE": true, "FALSE": true, "NULL": true, "UNKNOWN": true,
+	"NOT": true, "AND": true, "IS": true, "ISNULL": true, "NOTNULL": true,
+	"DISTINCT": true, "FROM": true, "IN": true, "BETWEEN": true, "SYMMETRIC": true,
+	"LIKE": true, "ILIKE": true, "SIMILAR": true, "TO": true, "ESCAPE": true,
+	"CASE": true, "WHEN": true, "THEN": true, "ELSE": true, "END": true,
+}
+
+// filtersRows reports whether every top level OR operand of the condition up
+// to RETURNING references something other than constants, parameters and
+// function calls, e.g. a column or a subquery, and so may be false for some
+// rows. Only conditions made of constants are recognized, not `id = id`.
+func filtersRows(condition []token) bool {
+	depth := 0
+	operand := false
+	for i, tok := range condition {
+		switch {
+		case tok.is(tokenPunct, "("):
+			depth++
+		case tok.is(tokenPunct, ")"):
+			depth--
+		case tok.isWord("RETURNING") && depth == 0:
+			return operand
+		case tok.isWord("OR") && depth == 0:
+			if !operand {
+				return false
+			}
+			operand = false
+		case tok.kind == tokenWord && constantWords[tok.text]:
+		case tok.kind == tokenWord || tok.kind == tokenQuotedIdent:
+			call := i+1 < len(condition) && condition[i+1].is(tokenPunct, "(")
+			cast := i > 0 && condition[i-1].is(tokenPunct, ":")
+			if !call && !cast {
+				operand = true
+			}
+		}
+	}
+
+	return operand
+}
+
+// classifyExplain unwraps `EXPLAIN ANALYZE`, which executes the statement.
+// A plain EXPLAIN only plans it and is a read.
+func classifyExplain(stmt *Statement, tokens []token) {
+	analyze, i := explainOptions(tokens)
+	if !analyze || i >= len(tokens) {
+		// nothing is executed, so called functions do not matter
+		stmt.SideEffects = nil
+		return
+	}
+
+	inner := &Statement{}
+	classifyTokens(inner, tokens[i:])
+	stmt.Command = inner.Command
+	stmt.Modifying = inner.Modifying
+	stmt.Unfiltered = inner.Unfiltered
+	stmt.Into = inner.Into
+	stmt.Locking = inner.Locking
+}
+
+// explainOptions reads the options following EXPLAIN. It reports whether
+// they include ANALYZE and returns the index of the explained statement.
+func explainOptions(tokens []token) (bool, int) {
+	analyze := false
+	i := 0
+	if i < len(tokens) && tokens[i].is(tokenPunct, "(") {
+		end := matchParen(tokens, i)
+		for j := i + 1; j < end; j++ {
+			if tokens[j].isWord("ANALYZE", "ANALYSE") {
+				analyze = !(j+1 < end && tokens[j+1].isWord("FALSE", "OFF") ||
+					j+1 < end && tokens[j+1].is(tokenNumber, "0"))
+			}
+		}
+		i = end + 1
+	} else {
+		for i < len(tokens) && tokens[i].isWord("ANALYZE", "ANALYSE", "VERBOSE") {
+			if tokens[i].isWord("ANALYZE", "ANALYSE") {
+				analyze = true
+			}
+			i++
+		}
+	}
+
+	return analyze, i
+}
+
+// ExplainTarget returns the statement of query that EXPLAIN can plan, the
+// query itself or the statement `EXPLAIN ANALYZE` runs. It returns "" for
+// SHOW and a plain EXPLAIN, which cannot be explained and run no plan.
+func ExplainTarget(query string) string {
+	tokens, err := tokenize(query)
+	if err != nil || len(tokens) == 0 {
+		return query
+	}
+
+	switch {
+	case tokens[0].isWord("SHOW"):
+		return ""
+	case tokens[0].isWord("EXPLAIN"):
+		analyze, i := explainOptions(tokens[1:])
+		if !analyze || 1+i >= len(tokens) {
+			return ""
+		}
+		return query[tokens[1+i].start:]
+	}
+
+	return query
+}
+
+// classifyWith walks the CTE list and classifies every CTE body as well as
+// the main statement that follows it.
+func classifyWith(stmt *Statement, tokens []token) {
+	i := 0
+	if i < len(tokens) && tokens[i].isWord("RECURSIVE") {
+		i++
+	}
+
+	for i < len(tokens) {
+		// name [ ( columns ) ] AS [ NOT ] [ MATERIALIZED ] ( body )
+		i++
+		if i < len(tokens) && tokens[i].is(tokenPunct, "(") {
+			i = matchParen(tokens, i) + 1
+		}
+		if i < len(tokens) && tokens[i].isWord("AS") {
+			i++
+		}
+		for i < len(tokens) && tokens[i].isWord("NOT", "MATERIALIZED") {
+			i++
+		}
+		if i >= len(tokens) || !tokens[i].is(tokenPunct, "(") {
+			break
+		}
+
+		end := matchParen(tokens, i)
+		body := &Statement{}
+		classifyTokens(body, tokens[i+1:end])
+		if !readCommands[body.Command] {
+			stmt.Modifying = append(stmt.Modifying, body.Command)
+		}
+		stmt.Modifying = append(stmt.Modifying, body.Modifying...)
+		stmt.Unfiltered = append(stmt.Unfiltered, body.Unfiltered...)
+		i = end + 1
+
+		// SEARCH ... SET column, CYCLE ... USING column
+		for i < len(tokens) && tokens[i].isWord("SEARCH", "CYCLE") {
+			last := "SET"
+			if tokens[i].isWord("CYCLE") {
+				last = "USING"
+			}
+			for i < len(tokens) && !tokens[i].isWord(last) {
+				i++
+			}
+			i += 2
+		}
+
+		if i < len(tokens) && tokens[i].is(tokenPunct, ",") {
+			i++
+			continue
+		}
+		break
+	}
+
+	if i >= len(tokens) {
+		return
+	}
+
+	main := &Statement{}
+	classifyTokens(main, tokens[i:])
+	stmt.Command = main.Command
+	stmt.Modifying = append(stmt.Modifying, main.Modifying...)
+	stmt.Unfiltered = append(stmt.Unfiltered, main.Unfiltered...)
+	stmt.Into = main.Into
+	stmt.Locking = main.Locking
+	stmt.Returning = main.Returning
+}
+
+// matchParen returns the index of the parenthesis closing the one at open, or
+// the last index when it is unbalanced.
+func matchParen(tokens []token, open int) int {
+	depth := 0
+	for i := open; i < len(tokens); i++ {
+		switch {
+		case tokens[i].is(tokenPunct, "("):
+			depth++
+		case tokens[i].is(tokenPunct, ")"):
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+
+	return len(tokens) - 1
+}
+
+// tokenize is a small Postgres lexer. It understands comments (including
+// nested block comments), standard and escape string literals, dollar quoted
+// strings, quoted identifiers and positional parameters, which is enough to
+// find statement boundaries and keywords reliably.
+func tokenize(query string) ([]token, error) {
+	tokens := []token{}
+	i := 0
+	for i < len(query) {
+		c := query[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f':
+			i++
+		case strings.HasPrefix(query[i:], "--"):
+			end := strings.IndexByte(query[i:], '\n')
+			if end < 0 {
+				i = len(query)
+			} else {
+				i += end + 1
+			}
+		case strings.HasPrefix(query[i:], "/*"):
+			end, err := scanBlockComment(query, i)
+			if err != nil {
+				return nil, err
+			}
+			i = end
+		case c == '\'':
+			end, err := scanString(query, i, false)
+			if err != nil {
+				return nil, err
+			}
+			tokens = append(tokens, token{kind: tokenString, start: i, end: end})
+			i = end
+		case (c == 'E' || c == 'e') && i+1 < len(query) && query[i+1] == '\'':
+			end, err := scanString(query, i+1, true)
+			if err != nil {
+				return nil, err
+			}
+			tokens = append(tokens, token{kind: tokenString, start: i, end: end})
+			i = end
+		case c == '"':
+			end := i + 1
+			for {
+				next := strings.IndexByte(query[end:], '"')
+				if next < 0 {
+					return nil, fmt.Errorf("unterminated quoted identifier at position %d", i+1)
+				}
+				end += next + 1
+				if end < len(query) && query[end] == '"' {
+					end++
+					continue
+				}
+				break
+			}
+			tokens = append(tokens, token{kind: tokenQuotedIdent, text: strings.ReplaceAll(query[i+1:end-1], `""`, `"`), start: i, end: end})
+			i = end
+		case c == '$':
+			if i+1 < len(query) && query[i+1] >= '0' && query[i+1] <= '9' {
+				end := i + 1
+				for end < len(query) && query[end] >= '0' && query[end] <= '9' {
+					end++
+				}
+				tokens = append(tokens, token{kind: tokenParam, text: query[i:end], start: i, end: end})
+				i = end
+				continue
+			}
+			end, err := scanDollarString(query, i)
+			if err != nil {
+				return nil, err
+			}
+			tokens = append(tokens, token{kind: tokenString, start: i, end: end})
+			i = end
+		case c >= '0' && c <= '9' || c == '.' && i+1 < len(query) && query[i+1] >= '0' && query[i+1] <= '9':
+			end := i + 1
+			for end < len(query) && (isIdentChar(query[end]) || query[end] == '.') {
+				end++
+			}
+			tokens = append(tokens, token{kind: tokenNumber, text: query[i:end], start: i, end: end})
+			i = end
+		case isIdentStart(query, i):
+			end := i
+			for end < len(query) && (isIdentChar(query[end]) || query[end] >= utf8.RuneSelf) {
+				end++
+			}
+			tokens = append(tokens, token{kind: tokenWord, text: strings.ToUpper(query[i:end]), start: i, end: end})
+			i = end
+		default:
+			tokens = append(tokens, token{kind: tokenPunct, text: string(c), start: i, end: i + 1})
+			i++
+		}
+	}
+
+	return tokens, nil
+}
+
+func isIdentStart(query string, i int) bool {
+	c := query[i]
+	if c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' {
+		return true
+	}
+	if c >= utf8.RuneSelf {
+		r, _ := utf8.DecodeRuneInString(query[i:])
+		return unicode.IsLetter(r)
+	}
+	return false
+}
+
+func isIdentChar(c byte) bool {
+	return c == '_' || c == '$' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9'
+}
+
+func scanBlockComment(query string, start int) (int, error) {
+	depth := 0
+	i := start
+	for i < len(query) {
+		switch {
+		case strings.HasPrefix(query[i:], "/*"):
+			depth++
+			i += 2
+		case strings.HasPrefix(query[i:], "*/"):
+			depth--
+			i += 2
+			if depth == 0 {
+				return i, nil
+			}
+		default:
+			i++
+		}
+	}
+
+	return 0, fmt.Errorf("unterminated comment at position %d", start+1)
+}
+
+// scanString returns the end of the string literal starting at the quote at
+// start. Quotes are escaped by doubling them, or with a backslash in E”.
+func scanString(query string, start int, backslash bool) (int, error) {
+	i := start + 1
+	for i < len(query) {
+		switch {
+		case backslash && query[i] == '\\':
+			i += 2
+		case query[i] == '\'':
+			if i+1 < len(query) && query[i+1] == '\'' {
+				i += 2
+				continue
+			}
+			return i + 1, nil
+		default:
+			i++
+		}
+	}
+
+	return 0, fmt.Errorf("unterminated string literal at position %d", start+1)
+}
+
+// scanDollarString returns the end of the $tag$...$tag$ string at start.
+func scanDollarString(query string, start int) (int, error) {
+	end := start + 1
+	for end < len(query) && query[end] != '$' {
+		if !isIdentChar(query[end]) {
+			return 0, fmt.Errorf("unexpected character %q at position %d", query[start], start+1)
+		}
+		end++
+	}
+	if end >= len(query) {
+		return 0, fmt.Errorf("unexpected character %q at position %d", query[start], start+1)
+	}
+
+	tag := query[start : end+1]
+	closing := strings.Index(query[end+1:], tag)
+	if closing < 0 {
+		return 0, fmt.Errorf("unterminated dollar-quoted string at position %d", start+1)
+	}
+
+	return end + 1 + closing + len(tag), nil
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClassifyStatements(t *testing.T) {
+	t.Run("splits on top level semicolons only", func(t *testing.T) {
+		query := `SELECT ';' AS a, $$ ; $$ AS b, $fn$ ; $fn$, E'\'; ' -- ; comment
+/* nested /* ; */ comment */ FROM "semi;colon"; DELETE FROM t;`
+
+		stmts, err := ClassifyStatements(query)
+
+		assert.NoError(t, err)
+		assert.Len(t, stmts, 2)
+		assert.Equal(t, "SELECT", stmts[0].Command)
+		assert.Equal(t, "DELETE", stmts[1].Command)
+		assert.Equal(t, "DELETE FROM t", stmts[1].Text)
+	})
+
+	t.Run("begin atomic function body", func(t *testing.T) {
+		query := `CREATE FUNCTION f() RETURNS int LANGUAGE sql BEGIN ATOMIC SELECT 1; SELECT 2; END; COMMENT ON FUNCTION f() IS 'x'`
+
+		stmts, err := ClassifyStatements(query)
+
+		assert.NoError(t, err)
+		assert.Len(t, stmts, 2)
+		assert.Equal(t, "CREATE", stmts[0].Command)
+		assert.Equal(t, "COMMENT", stmts[1].Command)
+	})
+
+	t.Run("returning clause", func(t *testing.T) {
+		returning := map[string]bool{
+			"INSERT INTO t (a) VALUES (1) RETURNING id":                                   true,
+			"UPDATE t SET a = 1 WHERE id = 2 returning *":                                 true,
+			"WITH moved AS (DELETE FROM t RETURNING *) INSERT INTO u SELECT * FROM moved": false,
+			"WITH n AS (SELECT 1 AS a) INSERT INTO t SELECT a FROM n RETURNING a":         true,
+			"DELETE FROM t WHERE note = 'returning'":                                      false,
+		}
+
+		for query, want := range returning {
+			stmts, err := ClassifyStatements(query)
+
+			assert.NoError(t, err)
+			assert.Equal(t, want, stmts[0].Returning, query)
+		}
+	})
+
+	t.Run("unterminated literals", func(t *testing.T) {
+		for _, query := range []string{"SELECT 'abc", `SELECT "abc`, "SELECT $$abc", "SELECT 1 /* abc"} {
+			_, err := ClassifyStatements(query)
+
+			assert.Error(t, err, query)
+		}
+	})
+}
+
+func TestCheckStatementType(t *testing.T) {
+	allowed := []struct {
+		query  string
+		expect string
+	}{
+		{"SELECT * FROM users WHERE id = $1", StatementTypeSelect},
+		{"  select count(*) from users;  ", StatementTypeSelect},
+		{"(SELECT 1) UNION ALL (SELECT 2)", StatementTypeSelect},
+		{"WITH recent AS (SELECT * FROM orders WHERE created_at > now() - interval '1 day') SELECT * FROM recent", StatementTypeSelect},
+		{"WITH RECURSIVE t(n) AS (VALUES (1) UNION ALL SELECT n + 1 FROM t WHERE n < 10) SEARCH DEPTH FIRST BY n SET ord SELECT * FROM t", StatementTypeSelect},
+		{"VALUES (1, 'a'), (2, 'b')", StatementTypeSelect},
+		{"TABLE users", StatementTypeSelect},
+		{"SHOW search_path", StatementTypeSelect},
+		{"EXPLAIN DELETE FROM users", StatementTypeSelect},
+		{"EXPLAIN (ANALYZE false) DELETE FROM users", StatementTypeSelect},
+		{"SELECT 'nextval(' || name FROM users", StatementTypeSelect},
+		{"SELECT substring(name FROM 1 FOR 3) FROM users", StatementTypeSelect},
+		{`SELECT "NextVal"('users_id_seq')`, StatementTypeSelect},
+		{"INSERT INTO users (name) VALUES ($1) RETURNING id", StatementTypeInsert},
+		{"INSERT INTO users (id, name) VALUES (nextval('users_id_seq'), 'x') ON CONFLICT (id) DO UPDATE SET name = EXCLUDED.name", StatementTypeInsert},
+		{"WITH src AS (SELECT * FROM staging) INSERT INTO users SELECT * FROM src", StatementTypeInsert},
+		{"UPDATE users SET name = 'x' WHERE id = 1", StatementTypeUpdate},
+		{"DELETE FROM users WHERE id = 1", StatementTypeDelete},
+		{"DELETE FROM users u USING banned b WHERE b.id = u.id", StatementTypeDelete},
+		{"UPDATE users SET name = 'x' WHERE CURRENT OF users_cursor", StatementTypeUpdate},
+		{"DELETE FROM users WHERE id = $1 OR (email IS NULL AND true)", StatementTypeDelete},
+		{"DELETE FROM users WHERE EXISTS (SELECT 1 FROM bans WHERE bans.user_id = users.id) RETURNING id", StatementTypeDelete},
+		{"CREATE TABLE t (id int); COMMENT ON TABLE t IS 'a; b'; COMMENT ON COLUMN t.id IS 'id'", StatementTypeCreate},
+		{"ALTER TABLE t ADD COLUMN name text; COMMENT ON COLUMN t.name IS 'name'", StatementTypeAlter},
+	}
+
+	for _, c := range allowed {
+		t.Run("allows "+c.query, func(t *testing.T) {
+			assert.NoError(t, CheckStatementType(c.query, c.expect))
+		})
+	}
+
+	denied := []struct {
+		query  string
+		expect string
+		reason string
+	}{
+		{"DROP TABLE users", StatementTypeSelect, "classified as DROP"},
+		{"SELECT 1; DROP TABLE users", StatementTypeSelect, "multiple statements are not allowed"},
+		{"DELETE FROM users", StatementTypeInsert, "classified as DELETE does not match the expected INSERT"},
+		{"WITH d AS (DELETE FROM users RETURNING *) SELECT * FROM d", StatementTypeSelect, "data-modifying DELETE"},
+		{"WITH d AS (WITH x AS (UPDATE users SET a = 1 RETURNING *) SELECT * FROM x) SELECT * FROM d", StatementTypeSelect, "data-modifying UPDATE"},
+		{"WITH d AS (DELETE FROM archive RETURNING *) INSERT INTO users SELECT * FROM d", StatementTypeInsert, "data-modifying DELETE"},
+		{"SELECT * INTO backup FROM users", StatementTypeSelect, "classified as SELECT INTO"},
+		{"SELECT * FROM users FOR UPDATE", StatementTypeSelect, "takes row locks"},
+		{"SELECT nextval('users_id_seq')", StatementTypeSelect, "nextval() which has side effects"},
+		{"SELECT NextVal('users_id_seq')", StatementTypeSelect, "nextval() which has side effects"},
+		{"SELECT pg_catalog.pg_terminate_backend(pid) FROM pg_stat_activity", StatementTypeSelect, "pg_terminate_backend()"},
+		{`SELECT "pg_terminate_backend"(123)`, StatementTypeSelect, "pg_terminate_backend()"},
+		{`SELECT "pg_catalog"."pg_terminate_backend"(123)`, StatementTypeSelect, "pg_terminate_backend()"},
+		{`SELECT "dblink_exec"('dbname=postgres', 'DROP TABLE users')`, StatementTypeSelect, "dblink_exec()"},
+		{"COPY users TO '/tmp/users.csv'", StatementTypeSelect, "classified as COPY"},
+		{"COPY (SELECT * FROM users) TO STDOUT", StatementTypeSelect, "classified as COPY"},
+		{"DO $$ BEGIN DELETE FROM users; END $$", StatementTypeSelect, "classified as DO"},
+		{"CALL cleanup()", StatementTypeUpdate, "classified as CALL"},
+		{"EXPLAIN ANALYZE DELETE FROM users", StatementTypeSelect, "classified as DELETE"},
+		{"EXPLAIN (VERBOSE, ANALYZE) UPDATE users SET a = 1", StatementTypeSelect, "classified as UPDATE"},
+		{"MERGE INTO users u USING staging s ON u.id = s.id WHEN MATCHED THEN DELETE", StatementTypeDelete, "classified as MERGE"},
+		{"TRUNCATE users", StatementTypeDelete, "classified as TRUNCATE"},
+		{"UPDATE users SET name = 'x'", StatementTypeUpdate, "UPDATE without a WHERE clause"},
+		{"DELETE FROM users", StatementTypeDelete, "DELETE without a WHERE clause"},
+		{"UPDATE users SET name = (SELECT name FROM staging WHERE id = 1)", StatementTypeUpdate, "UPDATE without a WHERE clause"},
+		{"WITH d AS (DELETE FROM users RETURNING id) DELETE FROM sessions WHERE user_id IN (SELECT id FROM d)", StatementTypeDelete, "DELETE without a WHERE clause"},
+		{"UPDATE users SET name = 'x' WHERE true", StatementTypeUpdate, "UPDATE without a WHERE clause, or with one that does not depend on the row"},
+		{"DELETE FROM users WHERE 1=1", StatementTypeDelete, "DELETE without a WHERE clause"},
+		{"DELETE FROM users WHERE (1 = 1) AND NOT false RETURNING id", StatementTypeDelete, "DELETE without a WHERE clause"},
+		{"DELETE FROM users WHERE id = 5 OR 'a' = 'a'", StatementTypeDelete, "DELETE without a WHERE clause"},
+		{"UPDATE users SET name = 'x' WHERE now()::date > '2020-01-01'::date", StatementTypeUpdate, "UPDATE without a WHERE clause"},
+		{"CREATE TABLE t (id int); DROP TABLE users", StatementTypeCreate, "classified as DROP"},
+		{"BEGIN; DELETE FROM users; COMMIT", StatementTypeDelete, "multiple statements are not allowed"},
+		{"   ;  ", StatementTypeSelect, "empty query"},
+		{"SELECT 'unterminated", StatementTypeSelect, "unable to parse query"},
+	}
+
+	for _, c := range denied {
+		t.Run("denies "+c.query, func(t *testing.T) {
+			err := CheckStatementType(c.query, c.expect)
+
+			assert.Error(t, err)
+			if err != nil {
+				assert.Contains(t, err.Error(), c.reason)
+			}
+		})
+	}
+
+	t.Run("allows unfiltered writes when enabled", func(t *testing.T) {
+		AllowUnfilteredWrites = true
+		defer func() { AllowUnfilteredWrites = false }()
+
+		assert.NoError(t, CheckStatementType("UPDATE users SET name = 'x'", StatementTypeUpdate))
+		assert.NoError(t, CheckStatementType("DELETE FROM users", StatementTypeDelete))
+	})
+
+	t.Run("denies data-modifying CTEs with an affected rows limit", func(t *testing.T) {
+		MaxAffectedRows = 10
+		defer func() { MaxAffectedRows = 0 }()
+
+		err := CheckStatementType("WITH d AS (DELETE FROM sessions WHERE user_id = 1 RETURNING id) DELETE FROM users WHERE id = 1", StatementTypeDelete)
+
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "data-modifying DELETE in a WITH clause are not counted against --max-affected-rows")
+		assert.NoError(t, CheckStatementType("WITH n AS (SELECT 1 AS id) DELETE FROM users WHERE id IN (SELECT id FROM n)", StatementTypeDelete))
+	})
+}
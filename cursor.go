@@ -0,0 +1,471 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// defaultCursorTTL is used when --idle-in-transaction-timeout is disabled.
+const defaultCursorTTL = time.Minute
+
+var (
+	DefaultRowLimit int
+	MaxRowLimit     int
+
+	// MaxCursors bounds the cursors kept open at once, each holds a pooled
+	// connection. MaxSessionCursors bounds those of a single session. 0
+	// disables a limit.
+	MaxCursors        int
+	MaxSessionCursors int
+)
+
+// QueryPage is one encoded page of a query result.
+type QueryPage struct {
+	Columns  []Column
+	Output   string
+	RowCount int
+	// Truncated is set when the row limit or the output budget cut the
+	// result short.
+	Truncated bool
+	// Cursor is the continuation token for the next page, empty when the
+	// result cannot be continued.
+	Cursor string
+	// Elapsed is the time spent executing the query and reading the page.
+	Elapsed time.Duration
+}
+
+// queryCursor is a server-side cursor kept open in its read-only
+// transaction between read_query calls.
+type queryCursor struct {
+	mu      sync.Mutex
+	token   string
+	name    string
+	session string
+	opened  time.Time
+	tx      *sqlx.Tx
+	columns []Column
+	// pending holds fetched rows that did not fit into the previous page.
+	pending [][]interface{}
+	// done is set once FETCH returned fewer rows than requested.
+	done   bool
+	timer  *time.Timer
+	closed bool
+}
+
+// cursorFetchSize bounds the rows fetched per round trip, and so the rows
+// held in memory when a page fills up in the middle of a batch.
+const cursorFetchSize = 100
+
+var (
+	cursorsMu sync.Mutex
+	cursors   = map[string]*queryCursor{}
+)
+
+// cursorableCommands can be used in DECLARE ... CURSOR FOR.
+var cursorableCommands = map[string]bool{
+	"SELECT": true,
+	"VALUES": true,
+	"TABLE":  true,
+}
+
+// RowLimit returns the requested row limit capped to --max-row-limit.
+func RowLimit(raw interface{}) int {
+	limit := DefaultRowLimit
+	if v, ok := raw.(float64); ok && v >= 1 {
+		limit = int(v)
+	}
+	if MaxRowLimit > 0 && limit > MaxRowLimit {
+		limit = MaxRowLimit
+	}
+
+	return limit
+}
+
+func cursorTTL() time.Duration {
+	if IdleInTransactionTimeout > 0 {
+		return IdleInTransactionTimeout
+	}
+
+	return defaultCursorTTL
+}
+
+// ReadQuery returns the first page of at most limit rows encoded as format.
+// When there are more rows, the query is kept open as a server-side cursor
+// and the page carries a token to continue it with ReadCursor. Inside a
+// session transaction the query sees its uncommitted changes and cannot be
+// continued.
+func ReadQuery(ctx context.Context, query, format string, limit int, args ...interface{}) (*QueryPage, error) {
+	if query == "" {
+		return nil, fmt.Errorf("query is required")
+	}
+
+	if err := CheckQuery(ctx, query, StatementTypeSelect, args...); err != nil {
+		return nil, err
+	}
+
+	stx, err := SessionTx(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if stx != nil {
+		return stx.Read(ctx, query, format, limit, args...)
+	}
+
+	stmts, err := ClassifyStatements(query)
+	if err != nil {
+		return nil, err
+	}
+
+	db, err := GetDB(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if !cursorableCommands[stmts[0].Command] {
+		// SHOW and EXPLAIN cannot be declared as cursors, their output is small
+		tx, err := BeginReadOnly(ctx, db)
+		if err != nil {
+			return nil, err
+		}
+		defer tx.Rollback()
+		return readRows(ctx, tx, query, format, limit, args...)
+	}
+
+	// The transaction of a cursor outlives this call, so it must not be
+	// rolled back when ctx is done. The statements below still use ctx. The
+	// server keeps it open a little longer than the cursor timer, so that
+	// the timer closes it first.
+	tx, err := beginTx(context.Background(), db, &sql.TxOptions{ReadOnly: true}, cursorTTL()+idleGrace)
+	if err != nil {
+		return nil, err
+	}
+
+	token, err := newCursorToken()
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	start := time.Now()
+	c := &queryCursor{token: token, name: "mcp_cursor_" + token, session: SessionID(ctx), opened: start, tx: tx}
+	if _, err := tx.ExecContext(ctx, fmt.Sprintf("DECLARE %s NO SCROLL CURSOR FOR %s", c.name, stmts[0].Text), args...); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	page, err := c.fetch(ctx, format, limit)
+	if err != nil {
+		c.close()
+		return nil, err
+	}
+
+	page.Elapsed = time.Since(start)
+	if !page.Truncated {
+		c.close()
+		return page, nil
+	}
+
+	evictCursors(c.session)
+
+	cursorsMu.Lock()
+	cursors[token] = c
+	cursorsMu.Unlock()
+	c.timer = time.AfterFunc(cursorTTL(), func() { CloseCursor(token) })
+
+	page.Cursor = token
+	return page, nil
+}
+
+// ReadCursor returns the next page of a cursor opened by ReadQuery.
+func ReadCursor(ctx context.Context, token, format string, limit int) (*QueryPage, error) {
+	cursorsMu.Lock()
+	c, ok := cursors[token]
+	cursorsMu.Unlock()
+	// the cursor of another session is not revealed
+	if !ok || c.session != SessionID(ctx) {
+		return nil, fmt.Errorf("cursor %q not found or expired, run the query again", token)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return nil, fmt.Errorf("cursor %q not found or expired, run the query again", token)
+	}
+
+	page, err := c.fetch(ctx, format, limit)
+	if err != nil || !page.Truncated {
+		c.remove()
+		return page, err
+	}
+
+	c.timer.Reset(cursorTTL())
+	page.Cursor = token
+	return page, nil
+}
+
+// CloseCursor closes the cursor and rolls back its transaction.
+func CloseCursor(token string) {
+	cursorsMu.Lock()
+	c, ok := cursors[token]
+	cursorsMu.Unlock()
+	if !ok {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.remove()
+}
+
+// evictCursors makes room for another cursor of session by closing the
+// oldest cursors over --max-session-cursors and --max-cursors.
+func evictCursors(session string) {
+	cursorsMu.Lock()
+	var evicted []*queryCursor
+	for MaxSessionCursors > 0 && sessionCursors(session) >= MaxSessionCursors {
+		evicted = append(evicted, takeOldestCursor(session, false))
+	}
+	for MaxCursors > 0 && len(cursors) >= MaxCursors {
+		evicted = append(evicted, takeOldestCursor(session, true))
+	}
+	cursorsMu.Unlock()
+
+	for _, c := range evicted {
+		c.mu.Lock()
+		c.timer.Stop()
+		c.close()
+		c.mu.Unlock()
+	}
+}
+
+// sessionCursors counts the open cursors of session, the caller must hold
+// cursorsMu.
+func sessionCursors(session string) int {
+	n := 0
+	for _, c := range cursors {
+		if c.session == session {
+			n++
+		}
+	}
+
+	return n
+}
+
+// takeOldestCursor unregisters the oldest cursor of session, or of all
+// sessions, the caller must hold cursorsMu and there has to be one.
+func takeOldestCursor(session string, all bool) *queryCursor {
+	var oldest *queryCursor
+	for _, c := range cursors {
+		if (all || c.session == session) && (oldest == nil || c.opened.Before(oldest.opened)) {
+			oldest = c
+		}
+	}
+	delete(cursors, oldest.token)
+
+	return oldest
+}
+
+// remove unregisters and closes the cursor, the caller must hold c.mu.
+func (c *queryCursor) remove() {
+	cursorsMu.Lock()
+	delete(cursors, c.token)
+	cursorsMu.Unlock()
+
+	if c.timer != nil {
+		c.timer.Stop()
+	}
+	c.close()
+}
+
+func (c *queryCursor) close() {
+	if !c.closed {
+		c.closed = true
+		c.tx.Rollback()
+	}
+}
+
+// fetch encodes the next page of at most limit rows. Rows fetched beyond
+// the end of the page are kept pending for the next one.
+func (c *queryCursor) fetch(ctx context.Context, format string, limit int) (*QueryPage, error) {
+	start := time.Now()
+	p := NewPageWriter(format, limit)
+	if c.columns != nil {
+		if err := p.WriteHeader(c.columns); err != nil {
+			return nil, err
+		}
+	}
+
+	for len(c.pending) > 0 {
+		ok, err := p.WriteRow(c.pending[0])
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			break
+		}
+		c.pending = c.pending[1:]
+	}
+
+	for len(c.pending) == 0 && !c.done {
+		// one row more than the page needs tells whether the result ends here
+		want := cursorFetchSize
+		if limit > 0 && limit-p.Rows+1 < want {
+			want = limit - p.Rows + 1
+		}
+
+		if err := c.fetchBatch(ctx, p, want); err != nil {
+			return nil, err
+		}
+	}
+
+	output, err := p.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	return &QueryPage{
+		Columns:   c.columns,
+		Output:    output,
+		RowCount:  p.Rows,
+		Truncated: len(c.pending) > 0,
+		Elapsed:   time.Since(start),
+	}, nil
+}
+
+func (c *queryCursor) fetchBatch(ctx context.Context, p *PageWriter, want int) error {
+	rows, err := c.tx.QueryxContext(ctx, fmt.Sprintf("FETCH FORWARD %d FROM %s", want, c.name))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	if c.columns == nil {
+		if c.columns, err = ResultColumns(rows); err != nil {
+			return err
+		}
+		if err := p.WriteHeader(c.columns); err != nil {
+			return err
+		}
+	}
+
+	got := 0
+	for rows.Next() {
+		got++
+		values, err := ScanValues(rows)
+		if err != nil {
+			return err
+		}
+
+		if len(c.pending) == 0 {
+			ok, err := p.WriteRow(values)
+			if err != nil {
+				return err
+			}
+			if ok {
+				continue
+			}
+		}
+		c.pending = append(c.pending, values)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	c.done = got < want
+	return nil
+}
+
+// readRows encodes at most limit rows of a query that cannot be continued.
+func readRows(ctx context.Context, tx *sqlx.Tx, query, format string, limit int, args ...interface{}) (*QueryPage, error) {
+	start := time.Now()
+	rows, err := tx.QueryxContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	cols, err := ResultColumns(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	p := NewPageWriter(format, limit)
+	if err := p.WriteHeader(cols); err != nil {
+		return nil, err
+	}
+
+	rest, err := p.WriteRows(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	output, err := p.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	return &QueryPage{
+		Columns:   cols,
+		Output:    output,
+		RowCount:  p.Rows,
+		Truncated: rest != nil,
+		Elapsed:   time.Since(start),
+	}, nil
+}
+
+func newCursorToken() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(b), nil
+}
+
+// PageInfo describes a page next to its rows, so that clients know the
+// column types without another desc_table call.
+type PageInfo struct {
+	Columns         []Column `json:"columns"`
+	RowCount        int      `json:"row_count"`
+	Truncated       bool     `json:"truncated"`
+	Cursor          string   `json:"cursor,omitempty"`
+	ExecutionTimeMs float64  `json:"execution_time_ms"`
+}
+
+// NewPageInfo returns the structured description of page.
+func NewPageInfo(page *QueryPage) PageInfo {
+	return PageInfo{
+		Columns:         page.Columns,
+		RowCount:        page.RowCount,
+		Truncated:       page.Truncated,
+		Cursor:          page.Cursor,
+		ExecutionTimeMs: float64(page.Elapsed.Microseconds()) / 1000,
+	}
+}
+
+// PageResult returns the encoded rows, followed by the page info as JSON.
+func PageResult(page *QueryPage) (*mcp.CallToolResult, error) {
+	info, err := json.Marshal(NewPageInfo(page))
+	if err != nil {
+		return nil, err
+	}
+
+	return &mcp.CallToolResult{
+		Content: []mcp.Content{
+			mcp.NewTextContent(page.Output),
+			mcp.NewTextContent(string(info)),
+		},
+	}, nil
+}
@@ -0,0 +1,280 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/stretchr/testify/assert"
+)
+
+// expectCursorTx sets up the transaction ReadQuery declares a cursor in
+func expectCursorTx(mock sqlmock.Sqlmock) {
+	mock.ExpectBegin()
+	mock.ExpectExec("set_config").
+		WithArgs(timeoutSetting(StatementTimeout), timeoutSetting(LockTimeout), timeoutSetting(cursorTTL()+idleGrace)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+}
+
+// expectOpenCursor sets up a cursor whose first page is truncated
+func expectOpenCursor(mock sqlmock.Sqlmock) {
+	expectCursorTx(mock)
+	mock.ExpectExec(`DECLARE mcp_cursor_[0-9a-f]+ NO SCROLL CURSOR FOR SELECT id FROM users`).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(`FETCH FORWARD 2 FROM mcp_cursor_[0-9a-f]+`).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1).AddRow(2))
+}
+
+func TestReadQuery(t *testing.T) {
+	t.Run("pages through a cursor", func(t *testing.T) {
+		_, mock, cleanup := setupMockDB(t)
+		defer cleanup()
+
+		// Setup mock expectations
+		expectCursorTx(mock)
+		mock.ExpectExec(`DECLARE mcp_cursor_[0-9a-f]+ NO SCROLL CURSOR FOR SELECT id FROM users WHERE id > \$1`).
+			WithArgs(int64(0)).
+			WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectQuery(`FETCH FORWARD 3 FROM mcp_cursor_[0-9a-f]+`).
+			WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1).AddRow(2).AddRow(3))
+		mock.ExpectQuery(`FETCH FORWARD 2 FROM mcp_cursor_[0-9a-f]+`).
+			WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(4))
+		mock.ExpectRollback()
+
+		// Call ReadQuery and ReadCursor
+		page, err := ReadQuery(context.Background(), "SELECT id FROM users WHERE id > $1", FormatCSV, 2, int64(0))
+		assert.NoError(t, err)
+		assert.Equal(t, "id\n1\n2\n", page.Output)
+		assert.Equal(t, 2, page.RowCount)
+		assert.True(t, page.Truncated)
+		assert.NotEmpty(t, page.Cursor)
+
+		next, err := ReadCursor(context.Background(), page.Cursor, FormatCSV, 2)
+
+		// Verify results
+		assert.NoError(t, err)
+		assert.Equal(t, "id", next.Columns[0].Name)
+		assert.Equal(t, "id\n3\n4\n", next.Output)
+		assert.Equal(t, 2, next.RowCount)
+		assert.False(t, next.Truncated)
+		assert.Empty(t, next.Cursor)
+		assert.NoError(t, mock.ExpectationsWereMet())
+
+		_, err = ReadCursor(context.Background(), page.Cursor, FormatCSV, 2)
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "not found or expired")
+	})
+
+	t.Run("single page closes the cursor", func(t *testing.T) {
+		_, mock, cleanup := setupMockDB(t)
+		defer cleanup()
+
+		// Setup mock expectations
+		expectCursorTx(mock)
+		mock.ExpectExec(`DECLARE mcp_cursor_[0-9a-f]+ NO SCROLL CURSOR FOR SELECT 1`).
+			WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectQuery(`FETCH FORWARD 11 FROM mcp_cursor_[0-9a-f]+`).
+			WillReturnRows(sqlmock.NewRows([]string{"?column?"}).AddRow(1))
+		mock.ExpectRollback()
+
+		// Call ReadQuery
+		page, err := ReadQuery(context.Background(), "SELECT 1", FormatCSV, 10)
+
+		// Verify results
+		assert.NoError(t, err)
+		assert.Equal(t, 1, page.RowCount)
+		assert.False(t, page.Truncated)
+		assert.Empty(t, page.Cursor)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("statements that cannot be declared as cursors", func(t *testing.T) {
+		_, mock, cleanup := setupMockDB(t)
+		defer cleanup()
+
+		// Setup mock expectations
+		expectTx(mock)
+		mock.ExpectQuery("SHOW search_path").
+			WillReturnRows(sqlmock.NewRows([]string{"search_path"}).AddRow("public"))
+		mock.ExpectRollback()
+
+		// Call ReadQuery
+		page, err := ReadQuery(context.Background(), "SHOW search_path", FormatCSV, 10)
+
+		// Verify results
+		assert.NoError(t, err)
+		assert.Equal(t, "search_path\npublic\n", page.Output)
+		assert.Empty(t, page.Cursor)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("output budget cuts the page at a row boundary", func(t *testing.T) {
+		_, mock, cleanup := setupMockDB(t)
+		defer cleanup()
+
+		maxOutputBytes := MaxOutputBytes
+		defer func() { MaxOutputBytes = maxOutputBytes }()
+		MaxOutputBytes = 20
+
+		// Setup mock expectations
+		expectCursorTx(mock)
+		mock.ExpectExec(`DECLARE mcp_cursor_[0-9a-f]+ NO SCROLL CURSOR FOR SELECT name FROM users`).
+			WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectQuery(`FETCH FORWARD 11 FROM mcp_cursor_[0-9a-f]+`).
+			WillReturnRows(sqlmock.NewRows([]string{"name"}).AddRow("alice").AddRow("bob").AddRow("carol").AddRow("dave"))
+		mock.ExpectRollback()
+
+		// Call ReadQuery and ReadCursor
+		page, err := ReadQuery(context.Background(), "SELECT name FROM users", FormatCSV, 10)
+		assert.NoError(t, err)
+		assert.Equal(t, "name\nalice\nbob\n", page.Output)
+		assert.True(t, page.Truncated)
+
+		next, err := ReadCursor(context.Background(), page.Cursor, FormatCSV, 10)
+
+		// Verify results
+		assert.NoError(t, err)
+		assert.Equal(t, "name\ncarol\ndave\n", next.Output)
+		assert.False(t, next.Truncated)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("closes the oldest cursor of the session at the limit", func(t *testing.T) {
+		_, mock, cleanup := setupMockDB(t)
+		defer cleanup()
+
+		maxSessionCursors := MaxSessionCursors
+		defer func() { MaxSessionCursors = maxSessionCursors }()
+		MaxSessionCursors = 1
+
+		// Setup mock expectations
+		expectOpenCursor(mock)
+		expectOpenCursor(mock)
+		mock.ExpectRollback()
+		expectOpenCursor(mock)
+		mock.ExpectRollback()
+		mock.ExpectRollback()
+
+		// Call ReadQuery
+		first, err := ReadQuery(sessionContext("a"), "SELECT id FROM users", FormatCSV, 1)
+		assert.NoError(t, err)
+		second, err := ReadQuery(sessionContext("a"), "SELECT id FROM users", FormatCSV, 1)
+		assert.NoError(t, err)
+		other, err := ReadQuery(sessionContext("b"), "SELECT id FROM users", FormatCSV, 1)
+		assert.NoError(t, err)
+
+		// Verify results
+		_, err = ReadCursor(sessionContext("a"), first.Cursor, FormatCSV, 1)
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "not found or expired")
+
+		CloseCursor(second.Cursor)
+		CloseCursor(other.Cursor)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("closes the oldest cursor at the overall limit", func(t *testing.T) {
+		_, mock, cleanup := setupMockDB(t)
+		defer cleanup()
+
+		maxCursors := MaxCursors
+		defer func() { MaxCursors = maxCursors }()
+		MaxCursors = 1
+
+		// Setup mock expectations
+		expectOpenCursor(mock)
+		expectOpenCursor(mock)
+		mock.ExpectRollback()
+		mock.ExpectRollback()
+
+		// Call ReadQuery
+		first, err := ReadQuery(sessionContext("a"), "SELECT id FROM users", FormatCSV, 1)
+		assert.NoError(t, err)
+		second, err := ReadQuery(sessionContext("b"), "SELECT id FROM users", FormatCSV, 1)
+		assert.NoError(t, err)
+
+		// Verify results
+		_, err = ReadCursor(sessionContext("a"), first.Cursor, FormatCSV, 1)
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "not found or expired")
+
+		CloseCursor(second.Cursor)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("cursors of other sessions are not found", func(t *testing.T) {
+		_, mock, cleanup := setupMockDB(t)
+		defer cleanup()
+
+		// Setup mock expectations
+		expectOpenCursor(mock)
+		mock.ExpectQuery(`FETCH FORWARD 2 FROM mcp_cursor_[0-9a-f]+`).
+			WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(3))
+		mock.ExpectRollback()
+
+		// Call ReadQuery, then ReadCursor from another session
+		page, err := ReadQuery(sessionContext("a"), "SELECT id FROM users", FormatCSV, 1)
+		assert.NoError(t, err)
+		_, err = ReadCursor(sessionContext("b"), page.Cursor, FormatCSV, 1)
+
+		// Verify results
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "not found or expired")
+
+		next, err := ReadCursor(sessionContext("a"), page.Cursor, FormatCSV, 2)
+		assert.NoError(t, err)
+		assert.Equal(t, "id\n2\n3\n", next.Output)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("unknown cursor", func(t *testing.T) {
+		_, err := ReadCursor(context.Background(), "missing", FormatCSV, 10)
+
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), `cursor "missing" not found or expired`)
+	})
+}
+
+func TestRowLimit(t *testing.T) {
+	defaultLimit, maxLimit := DefaultRowLimit, MaxRowLimit
+	defer func() { DefaultRowLimit, MaxRowLimit = defaultLimit, maxLimit }()
+	DefaultRowLimit, MaxRowLimit = 100, 500
+
+	assert.Equal(t, 100, RowLimit(nil))
+	assert.Equal(t, 100, RowLimit(float64(0)))
+	assert.Equal(t, 20, RowLimit(float64(20)))
+	assert.Equal(t, 500, RowLimit(float64(5000)))
+}
+
+func TestPageResult(t *testing.T) {
+	notNull := false
+	page := &QueryPage{
+		Columns: []Column{
+			{Name: "id", Type: "int4", TypeOID: 23, Nullable: &notNull},
+			{Name: "tags", Type: "_text", TypeOID: 1009},
+		},
+		Output:    "id,tags\n1,{a}\n",
+		RowCount:  1,
+		Truncated: true,
+		Cursor:    "abc",
+		Elapsed:   1500 * time.Microsecond,
+	}
+
+	result, err := PageResult(page)
+
+	assert.NoError(t, err)
+	assert.False(t, result.IsError)
+	assert.Equal(t, "id,tags\n1,{a}\n", result.Content[0].(mcp.TextContent).Text)
+	assert.JSONEq(t, `{
+		"columns": [
+			{"name": "id", "type": "int4", "type_oid": 23, "nullable": false},
+			{"name": "tags", "type": "_text", "type_oid": 1009, "nullable": null}
+		],
+		"row_count": 1,
+		"truncated": true,
+		"cursor": "abc",
+		"execution_time_ms": 1.5
+	}`, result.Content[1].(mcp.TextContent).Text)
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+var (
+	// ToolTimeout bounds every tool call, 0 disables the deadline.
+	ToolTimeout time.Duration
+
+	// ToolTimeouts overrides ToolTimeout for single tools by name.
+	ToolTimeouts map[string]time.Duration
+)
+
+// ParseToolTimeouts parses a comma separated list of tool=duration pairs,
+// e.g. "read_query=2m,write_query=30s".
+func ParseToolTimeouts(spec string) (map[string]time.Duration, error) {
+	timeouts := map[string]time.Duration{}
+	for _, item := range strings.Split(spec, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+
+		name, value, ok := strings.Cut(item, "=")
+		if !ok || strings.TrimSpace(name) == "" {
+			return nil, fmt.Errorf("invalid tool timeout %q, expected tool=duration", item)
+		}
+
+		d, err := time.ParseDuration(strings.TrimSpace(value))
+		if err != nil {
+			return nil, fmt.Errorf("invalid tool timeout %q: %v", item, err)
+		}
+		if d < 0 {
+			return nil, fmt.Errorf("invalid tool timeout %q: negative duration", item)
+		}
+		timeouts[strings.TrimSpace(name)] = d
+	}
+
+	return timeouts, nil
+}
+
+// ToolDeadline returns the timeout of a tool, see ToolTimeout and
+// ToolTimeouts.
+func ToolDeadline(name string) time.Duration {
+	if d, ok := ToolTimeouts[name]; ok {
+		return d
+	}
+
+	return ToolTimeout
+}
+
+// WithToolTimeout runs handler with the deadline of the tool applied to its
+// context, which is also canceled when the client cancels the call. The
+// context is passed down to the database calls, so that pgx cancels the
+// running statement on the server once the deadline passes.
+func WithToolTimeout(name string, handler server.ToolHandlerFunc) server.ToolHandlerFunc {
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		ctx, done := WithCancel(ctx)
+		defer done()
+
+		if d := ToolDeadline(name); d > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, d)
+			defer cancel()
+		}
+
+		result, err := handler(ctx, request)
+		if err == nil && result != nil && result.IsError && ctx.Err() == context.DeadlineExceeded {
+			return ErrorResult(errors.New(TData("error.timeout", map[string]interface{}{
+				"Tool":    name,
+				"Timeout": ToolDeadline(name).String(),
+			}))), nil
+		}
+
+		return result, err
+	}
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseToolTimeouts(t *testing.T) {
+	timeouts, err := ParseToolTimeouts(" read_query=2m, write_query=30s,,delete_query=0")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]time.Duration{
+		"read_query":   2 * time.Minute,
+		"write_query":  30 * time.Second,
+		"delete_query": 0,
+	}, timeouts)
+
+	for _, spec := range []string{"read_query", "=1s", "read_query=soon", "read_query=-1s"} {
+		_, err := ParseToolTimeouts(spec)
+		assert.Error(t, err, spec)
+	}
+}
+
+func TestWithToolTimeout(t *testing.T) {
+	originalTimeout, originalTimeouts := ToolTimeout, ToolTimeouts
+	defer func() { ToolTimeout, ToolTimeouts = originalTimeout, originalTimeouts }()
+	ToolTimeout = time.Minute
+	ToolTimeouts = map[string]time.Duration{"read_query": 20 * time.Millisecond, "write_query": 0}
+
+	handler := func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		<-ctx.Done()
+		return ErrorResult(ctx.Err()), nil
+	}
+
+	t.Run("deadline exceeded", func(t *testing.T) {
+		// Call the wrapped handler
+		result, err := WithToolTimeout("read_query", handler)(context.Background(), mcp.CallToolRequest{})
+
+		// Verify results
+		assert.NoError(t, err)
+		assert.True(t, result.IsError)
+		assert.Contains(t, result.Content[0].(mcp.TextContent).Text, "read_query exceeded its 20ms deadline")
+	})
+
+	t.Run("disabled for a tool", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		// Call the wrapped handler, only the client cancellation ends it
+		result, err := WithToolTimeout("write_query", handler)(ctx, mcp.CallToolRequest{})
+
+		// Verify results
+		assert.NoError(t, err)
+		assert.Contains(t, result.Content[0].(mcp.TextContent).Text, "context canceled")
+	})
+
+	assert.Equal(t, time.Minute, ToolDeadline("list_table"))
+}
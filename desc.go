@@ -0,0 +1,347 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+// relationOID selects the OID of the relation named by $1 (schema) and $2
+// (name), every catalog query below is bound to it.
+const relationOID = `(SELECT c.oid FROM pg_catalog.pg_class c
+  JOIN pg_catalog.pg_namespace n ON n.oid = c.relnamespace
+  WHERE n.nspname = $1 AND c.relname = $2)`
+
+type relationDef struct {
+	Kind             string         `db:"relkind"`
+	Persistence      string         `db:"relpersistence"`
+	IsPartition      bool           `db:"relispartition"`
+	RowSecurity      bool           `db:"relrowsecurity"`
+	ForceRowSecurity bool           `db:"relforcerowsecurity"`
+	PartitionKey     sql.NullString `db:"partition_key"`
+	PartitionBound   sql.NullString `db:"partition_bound"`
+	ViewDefinition   sql.NullString `db:"view_definition"`
+	Server           sql.NullString `db:"server"`
+	Comment          sql.NullString `db:"comment"`
+}
+
+type columnDef struct {
+	Name      string         `db:"name"`
+	Type      string         `db:"type"`
+	NotNull   bool           `db:"not_null"`
+	Default   sql.NullString `db:"default_value"`
+	Identity  string         `db:"identity"`
+	Generated string         `db:"generated"`
+	Collation sql.NullString `db:"collation"`
+	Comment   sql.NullString `db:"comment"`
+}
+
+type constraintDef struct {
+	Name       string `db:"name"`
+	Definition string `db:"definition"`
+}
+
+type triggerDef struct {
+	Name       string `db:"name"`
+	Definition string `db:"definition"`
+	Disabled   bool   `db:"disabled"`
+}
+
+type partitionDef struct {
+	Name  string `db:"name"`
+	Bound string `db:"bound"`
+}
+
+type policyDef struct {
+	Name       string         `db:"name"`
+	Permissive bool           `db:"permissive"`
+	Command    string         `db:"command"`
+	Roles      string         `db:"roles"`
+	Using      sql.NullString `db:"using_expr"`
+	WithCheck  sql.NullString `db:"check_expr"`
+}
+
+var relationKeywords = map[string]string{
+	"r": "TABLE",
+	"p": "TABLE",
+	"v": "VIEW",
+	"m": "MATERIALIZED VIEW",
+	"f": "FOREIGN TABLE",
+}
+
+var policyCommands = map[string]string{
+	"*": "ALL",
+	"r": "SELECT",
+	"a": "INSERT",
+	"w": "UPDATE",
+	"d": "DELETE",
+}
+
+// HandleDescTable reconstructs the DDL of a relation from pg_catalog, in
+// the spirit of pg_dump --schema-only -t: columns with defaults, identity and
+// generated columns, constraints, indexes, partitions, triggers, row level
+// security policies and comments.
+func HandleDescTable(ctx context.Context, schema, table string) (string, error) {
+	db, err := GetDB(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	tx, err := BeginReadOnly(ctx, db)
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback()
+
+	var rel relationDef
+	err = tx.GetContext(ctx, &rel, `SELECT c.relkind::text AS relkind, c.relpersistence::text AS relpersistence,
+       c.relispartition, c.relrowsecurity, c.relforcerowsecurity,
+       pg_catalog.pg_get_partkeydef(c.oid) AS partition_key,
+       pg_catalog.pg_get_expr(c.relpartbound, c.oid) AS partition_bound,
+       CASE WHEN c.relkind IN ('v', 'm') THEN pg_catalog.pg_get_viewdef(c.oid, true) END AS view_definition,
+       (SELECT quote_ident(s.srvname) FROM pg_catalog.pg_foreign_table ft
+          JOIN pg_catalog.pg_foreign_server s ON s.oid = ft.ftserver
+          WHERE ft.ftrelid = c.oid) AS server,
+       quote_literal(pg_catalog.obj_description(c.oid, 'pg_class')) AS comment
+FROM pg_catalog.pg_class c
+WHERE c.oid = `+relationOID, schema, table)
+	if err == sql.ErrNoRows {
+		return "", fmt.Errorf("relation %q not found", schema+"."+table)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	var columns []columnDef
+	err = tx.SelectContext(ctx, &columns, `SELECT quote_ident(a.attname) AS name,
+       pg_catalog.format_type(a.atttypid, a.atttypmod) AS type,
+       a.attnotnull AS not_null,
+       pg_catalog.pg_get_expr(d.adbin, d.adrelid) AS default_value,
+       a.attidentity::text AS identity,
+       a.attgenerated::text AS generated,
+       (SELECT quote_ident(co.collname) FROM pg_catalog.pg_collation co
+          WHERE co.oid = a.attcollation AND a.attcollation <> t.typcollation) AS collation,
+       quote_literal(pg_catalog.col_description(a.attrelid, a.attnum)) AS comment
+FROM pg_catalog.pg_attribute a
+JOIN pg_catalog.pg_type t ON t.oid = a.atttypid
+LEFT JOIN pg_catalog.pg_attrdef d ON d.adrelid = a.attrelid AND d.adnum = a.attnum
+WHERE a.attrelid = `+relationOID+` AND a.attnum > 0 AND NOT a.attisdropped
+ORDER BY a.attnum`, schema, table)
+	if err != nil {
+		return "", err
+	}
+
+	var parents []string
+	err = tx.SelectContext(ctx, &parents, `SELECT i.inhparent::pg_catalog.regclass::text
+FROM pg_catalog.pg_inherits i
+WHERE i.inhrelid = `+relationOID+`
+ORDER BY i.inhseqno`, schema, table)
+	if err != nil {
+		return "", err
+	}
+
+	// NOT NULL constraints are part of the columns already
+	var constraints []constraintDef
+	err = tx.SelectContext(ctx, &constraints, `SELECT quote_ident(co.conname) AS name,
+       pg_catalog.pg_get_constraintdef(co.oid, true) AS definition
+FROM pg_catalog.pg_constraint co
+WHERE co.conrelid = `+relationOID+` AND co.conislocal AND co.contype <> 'n'
+ORDER BY array_position(ARRAY['p', 'u', 'x', 'c', 'f'], co.contype::text), co.conname`, schema, table)
+	if err != nil {
+		return "", err
+	}
+
+	// indexes backing a constraint are created by the constraint
+	var indexes []string
+	err = tx.SelectContext(ctx, &indexes, `SELECT pg_catalog.pg_get_indexdef(i.indexrelid)
+FROM pg_catalog.pg_index i
+JOIN pg_catalog.pg_class ic ON ic.oid = i.indexrelid
+WHERE i.indrelid = `+relationOID+`
+  AND NOT EXISTS (SELECT 1 FROM pg_catalog.pg_constraint co
+                  WHERE co.conindid = i.indexrelid AND co.conrelid = i.indrelid AND co.contype IN ('p', 'u', 'x'))
+ORDER BY ic.relname`, schema, table)
+	if err != nil {
+		return "", err
+	}
+
+	var partitions []partitionDef
+	if rel.Kind == "p" {
+		err = tx.SelectContext(ctx, &partitions, `SELECT c.oid::pg_catalog.regclass::text AS name,
+       pg_catalog.pg_get_expr(c.relpartbound, c.oid) AS bound
+FROM pg_catalog.pg_inherits i
+JOIN pg_catalog.pg_class c ON c.oid = i.inhrelid
+WHERE i.inhparent = `+relationOID+`
+ORDER BY c.relname`, schema, table)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	var triggers []triggerDef
+	err = tx.SelectContext(ctx, &triggers, `SELECT quote_ident(tg.tgname) AS name,
+       pg_catalog.pg_get_triggerdef(tg.oid, true) AS definition,
+       tg.tgenabled = 'D' AS disabled
+FROM pg_catalog.pg_trigger tg
+WHERE tg.tgrelid = `+relationOID+` AND NOT tg.tgisinternal
+ORDER BY tg.tgname`, schema, table)
+	if err != nil {
+		return "", err
+	}
+
+	var policies []policyDef
+	err = tx.SelectContext(ctx, &policies, `SELECT quote_ident(p.polname) AS name,
+       p.polpermissive AS permissive,
+       p.polcmd::text AS command,
+       CASE WHEN p.polroles = '{0}' THEN 'PUBLIC'
+            ELSE (SELECT string_agg(quote_ident(r.rolname), ', ' ORDER BY r.rolname)
+                  FROM pg_catalog.pg_roles r WHERE r.oid = ANY (p.polroles)) END AS roles,
+       pg_catalog.pg_get_expr(p.polqual, p.polrelid) AS using_expr,
+       pg_catalog.pg_get_expr(p.polwithcheck, p.polrelid) AS check_expr
+FROM pg_catalog.pg_policy p
+WHERE p.polrelid = `+relationOID+`
+ORDER BY p.polname`, schema, table)
+	if err != nil {
+		return "", err
+	}
+
+	name := QualifiedName(schema, table)
+	keyword := relationKeywords[rel.Kind]
+	sections := []string{createStatement(name, rel, columns, constraints, parents)}
+
+	var stmts []string
+	for _, index := range indexes {
+		stmts = append(stmts, index+";")
+	}
+	for _, partition := range partitions {
+		stmts = append(stmts, fmt.Sprintf("ALTER TABLE ONLY %s ATTACH PARTITION %s %s;", name, partition.Name, partition.Bound))
+	}
+	for _, trigger := range triggers {
+		stmts = append(stmts, trigger.Definition+";")
+		if trigger.Disabled {
+			stmts = append(stmts, fmt.Sprintf("ALTER TABLE %s DISABLE TRIGGER %s;", name, trigger.Name))
+		}
+	}
+	sections = appendSection(sections, stmts)
+
+	stmts = nil
+	if rel.RowSecurity {
+		stmts = append(stmts, fmt.Sprintf("ALTER TABLE %s ENABLE ROW LEVEL SECURITY;", name))
+	}
+	if rel.ForceRowSecurity {
+		stmts = append(stmts, fmt.Sprintf("ALTER TABLE %s FORCE ROW LEVEL SECURITY;", name))
+	}
+	for _, policy := range policies {
+		stmts = append(stmts, policyStatement(name, policy))
+	}
+	sections = appendSection(sections, stmts)
+
+	stmts = nil
+	if rel.Comment.Valid {
+		stmts = append(stmts, fmt.Sprintf("COMMENT ON %s %s IS %s;", keyword, name, rel.Comment.String))
+	}
+	for _, col := range columns {
+		if col.Comment.Valid {
+			stmts = append(stmts, fmt.Sprintf("COMMENT ON COLUMN %s.%s IS %s;", name, col.Name, col.Comment.String))
+		}
+	}
+	sections = appendSection(sections, stmts)
+
+	return strings.Join(sections, "\n\n") + "\n", nil
+}
+
+func createStatement(name string, rel relationDef, columns []columnDef, constraints []constraintDef, parents []string) string {
+	keyword := relationKeywords[rel.Kind]
+	if rel.Persistence == "u" {
+		keyword = "UNLOGGED " + keyword
+	}
+
+	if rel.ViewDefinition.Valid {
+		def := strings.TrimSuffix(strings.TrimSpace(rel.ViewDefinition.String), ";")
+		return fmt.Sprintf("CREATE %s %s AS\n %s;", keyword, name, def)
+	}
+
+	var elems []string
+	if !rel.IsPartition {
+		for _, col := range columns {
+			elems = append(elems, "    "+columnDefinition(col))
+		}
+	}
+	for _, con := range constraints {
+		elems = append(elems, "    CONSTRAINT "+con.Name+" "+con.Definition)
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "CREATE %s %s", keyword, name)
+	if rel.IsPartition && len(parents) > 0 {
+		fmt.Fprintf(&b, " PARTITION OF %s", parents[0])
+	}
+	if len(elems) > 0 || !rel.IsPartition {
+		b.WriteString(" (\n" + strings.Join(elems, ",\n") + "\n)")
+	}
+	if rel.IsPartition {
+		b.WriteString("\n" + rel.PartitionBound.String)
+	} else if len(parents) > 0 {
+		b.WriteString("\nINHERITS (" + strings.Join(parents, ", ") + ")")
+	}
+	if rel.PartitionKey.Valid {
+		b.WriteString("\nPARTITION BY " + rel.PartitionKey.String)
+	}
+	if rel.Server.Valid {
+		b.WriteString("\nSERVER " + rel.Server.String)
+	}
+	b.WriteString(";")
+
+	return b.String()
+}
+
+func columnDefinition(col columnDef) string {
+	def := col.Name + " " + col.Type
+	if col.Collation.Valid {
+		def += " COLLATE " + col.Collation.String
+	}
+
+	switch {
+	case col.Identity == "a":
+		def += " GENERATED ALWAYS AS IDENTITY"
+	case col.Identity == "d":
+		def += " GENERATED BY DEFAULT AS IDENTITY"
+	case col.Generated == "s" && col.Default.Valid:
+		def += " GENERATED ALWAYS AS (" + col.Default.String + ") STORED"
+	case col.Default.Valid:
+		def += " DEFAULT " + col.Default.String
+	}
+
+	if col.NotNull {
+		def += " NOT NULL"
+	}
+
+	return def
+}
+
+func policyStatement(name string, policy policyDef) string {
+	stmt := fmt.Sprintf("CREATE POLICY %s ON %s", policy.Name, name)
+	if !policy.Permissive {
+		stmt += " AS RESTRICTIVE"
+	}
+	if command := policyCommands[policy.Command]; command != "ALL" {
+		stmt += " FOR " + command
+	}
+	stmt += " TO " + policy.Roles
+	if policy.Using.Valid {
+		stmt += " USING (" + policy.Using.String + ")"
+	}
+	if policy.WithCheck.Valid {
+		stmt += " WITH CHECK (" + policy.WithCheck.String + ")"
+	}
+
+	return stmt + ";"
+}
+
+func appendSection(sections, stmts []string) []string {
+	if len(stmts) == 0 {
+		return sections
+	}
+
+	return append(sections, strings.Join(stmts, "\n"))
+}
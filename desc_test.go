@@ -0,0 +1,159 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHandleDescTable(t *testing.T) {
+	relationColumns := []string{"relkind", "relpersistence", "relispartition", "relrowsecurity", "relforcerowsecurity",
+		"partition_key", "partition_bound", "view_definition", "server", "comment"}
+	columnColumns := []string{"name", "type", "not_null", "default_value", "identity", "generated", "collation", "comment"}
+
+	t.Run("table", func(t *testing.T) {
+		_, mock, cleanup := setupMockDB(t)
+		defer cleanup()
+
+		// Setup mock expectations
+		expectTx(mock)
+		mock.ExpectQuery("pg_get_partkeydef").WithArgs("public", "orders").
+			WillReturnRows(sqlmock.NewRows(relationColumns).
+				AddRow("r", "p", false, true, false, nil, nil, nil, nil, "'Customer orders'"))
+		mock.ExpectQuery("format_type").WithArgs("public", "orders").
+			WillReturnRows(sqlmock.NewRows(columnColumns).
+				AddRow("id", "bigint", true, nil, "a", "", nil, nil).
+				AddRow("status", "text", true, "'new'::text", "", "", `"C"`, "'Order status'").
+				AddRow("total", "numeric(10,2)", false, "(price * quantity)", "", "s", nil, nil))
+		mock.ExpectQuery("pg_inherits").WithArgs("public", "orders").
+			WillReturnRows(sqlmock.NewRows([]string{"inhparent"}))
+		mock.ExpectQuery("pg_get_constraintdef").WithArgs("public", "orders").
+			WillReturnRows(sqlmock.NewRows([]string{"name", "definition"}).
+				AddRow("orders_pkey", "PRIMARY KEY (id)").
+				AddRow("orders_user_fk", "FOREIGN KEY (user_id) REFERENCES users(id)"))
+		mock.ExpectQuery("pg_get_indexdef").WithArgs("public", "orders").
+			WillReturnRows(sqlmock.NewRows([]string{"pg_get_indexdef"}).
+				AddRow("CREATE INDEX orders_status_idx ON public.orders USING btree (status)"))
+		mock.ExpectQuery("pg_get_triggerdef").WithArgs("public", "orders").
+			WillReturnRows(sqlmock.NewRows([]string{"name", "definition", "disabled"}).
+				AddRow("orders_audit", "CREATE TRIGGER orders_audit AFTER UPDATE ON public.orders FOR EACH ROW EXECUTE FUNCTION audit()", true))
+		mock.ExpectQuery("pg_policy").WithArgs("public", "orders").
+			WillReturnRows(sqlmock.NewRows([]string{"name", "permissive", "command", "roles", "using_expr", "check_expr"}).
+				AddRow("own_orders", true, "r", "app_user", "(owner = CURRENT_USER)", nil))
+		mock.ExpectRollback()
+
+		// Call HandleDescTable
+		result, err := HandleDescTable(context.Background(), "public", "orders")
+
+		// Verify results
+		assert.NoError(t, err)
+		assert.Equal(t, `CREATE TABLE "public"."orders" (
+    id bigint GENERATED ALWAYS AS IDENTITY NOT NULL,
+    status text COLLATE "C" DEFAULT 'new'::text NOT NULL,
+    total numeric(10,2) GENERATED ALWAYS AS ((price * quantity)) STORED,
+    CONSTRAINT orders_pkey PRIMARY KEY (id),
+    CONSTRAINT orders_user_fk FOREIGN KEY (user_id) REFERENCES users(id)
+);
+
+CREATE INDEX orders_status_idx ON public.orders USING btree (status);
+CREATE TRIGGER orders_audit AFTER UPDATE ON public.orders FOR EACH ROW EXECUTE FUNCTION audit();
+ALTER TABLE "public"."orders" DISABLE TRIGGER orders_audit;
+
+ALTER TABLE "public"."orders" ENABLE ROW LEVEL SECURITY;
+CREATE POLICY own_orders ON "public"."orders" FOR SELECT TO app_user USING ((owner = CURRENT_USER));
+
+COMMENT ON TABLE "public"."orders" IS 'Customer orders';
+COMMENT ON COLUMN "public"."orders".status IS 'Order status';
+`, result)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("partitioned table", func(t *testing.T) {
+		_, mock, cleanup := setupMockDB(t)
+		defer cleanup()
+
+		// Setup mock expectations
+		expectTx(mock)
+		mock.ExpectQuery("pg_get_partkeydef").
+			WillReturnRows(sqlmock.NewRows(relationColumns).
+				AddRow("p", "p", false, false, false, "RANGE (created_at)", nil, nil, nil, nil))
+		mock.ExpectQuery("format_type").
+			WillReturnRows(sqlmock.NewRows(columnColumns).
+				AddRow("created_at", "date", true, nil, "", "", nil, nil))
+		mock.ExpectQuery("pg_inherits").WillReturnRows(sqlmock.NewRows([]string{"inhparent"}))
+		mock.ExpectQuery("pg_get_constraintdef").WillReturnRows(sqlmock.NewRows([]string{"name", "definition"}))
+		mock.ExpectQuery("pg_get_indexdef").WillReturnRows(sqlmock.NewRows([]string{"pg_get_indexdef"}))
+		mock.ExpectQuery("pg_inherits").
+			WillReturnRows(sqlmock.NewRows([]string{"name", "bound"}).
+				AddRow("events_2024", "FOR VALUES FROM ('2024-01-01') TO ('2025-01-01')"))
+		mock.ExpectQuery("pg_get_triggerdef").WillReturnRows(sqlmock.NewRows([]string{"name", "definition", "disabled"}))
+		mock.ExpectQuery("pg_policy").WillReturnRows(sqlmock.NewRows([]string{"name", "permissive", "command", "roles", "using_expr", "check_expr"}))
+		mock.ExpectRollback()
+
+		// Call HandleDescTable
+		result, err := HandleDescTable(context.Background(), "public", "events")
+
+		// Verify results
+		assert.NoError(t, err)
+		assert.Equal(t, `CREATE TABLE "public"."events" (
+    created_at date NOT NULL
+)
+PARTITION BY RANGE (created_at);
+
+ALTER TABLE ONLY "public"."events" ATTACH PARTITION events_2024 FOR VALUES FROM ('2024-01-01') TO ('2025-01-01');
+`, result)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("view", func(t *testing.T) {
+		_, mock, cleanup := setupMockDB(t)
+		defer cleanup()
+
+		// Setup mock expectations
+		expectTx(mock)
+		mock.ExpectQuery("pg_get_partkeydef").
+			WillReturnRows(sqlmock.NewRows(relationColumns).
+				AddRow("v", "p", false, false, false, nil, nil, " SELECT id\n   FROM orders;", nil, nil))
+		mock.ExpectQuery("format_type").
+			WillReturnRows(sqlmock.NewRows(columnColumns).
+				AddRow("id", "bigint", false, nil, "", "", nil, "'Order id'"))
+		mock.ExpectQuery("pg_inherits").WillReturnRows(sqlmock.NewRows([]string{"inhparent"}))
+		mock.ExpectQuery("pg_get_constraintdef").WillReturnRows(sqlmock.NewRows([]string{"name", "definition"}))
+		mock.ExpectQuery("pg_get_indexdef").WillReturnRows(sqlmock.NewRows([]string{"pg_get_indexdef"}))
+		mock.ExpectQuery("pg_get_triggerdef").WillReturnRows(sqlmock.NewRows([]string{"name", "definition", "disabled"}))
+		mock.ExpectQuery("pg_policy").WillReturnRows(sqlmock.NewRows([]string{"name", "permissive", "command", "roles", "using_expr", "check_expr"}))
+		mock.ExpectRollback()
+
+		// Call HandleDescTable
+		result, err := HandleDescTable(context.Background(), "public", "order_ids")
+
+		// Verify results
+		assert.NoError(t, err)
+		assert.Equal(t, `CREATE VIEW "public"."order_ids" AS
+ SELECT id
+   FROM orders;
+
+COMMENT ON COLUMN "public"."order_ids".id IS 'Order id';
+`, result)
+	})
+
+	t.Run("query error", func(t *testing.T) {
+		_, mock, cleanup := setupMockDB(t)
+		defer cleanup()
+
+		// Setup mock expectations
+		expectTx(mock)
+		mock.ExpectQuery("pg_get_partkeydef").WillReturnError(fmt.Errorf("query error"))
+		mock.ExpectRollback()
+
+		// Call HandleDescTable
+		_, err := HandleDescTable(context.Background(), "public", "orders")
+
+		// Verify results
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "query error")
+	})
+}
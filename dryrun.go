@@ -0,0 +1,347 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// DryRunResult is the outcome of an UPDATE or DELETE that was executed and
+// rolled back.
+type DryRunResult struct {
+	Type         string
+	RowsAffected int64
+	// Before holds a sample of the rows as they were before the statement,
+	// for DELETE the deleted rows. It is nil when the pre-image could not be
+	// read, e.g. for statements starting with WITH.
+	Before *QueryPage
+	// After holds a sample of the updated rows, nil for DELETE. When the
+	// target table has a primary key, both samples are ordered by it and so
+	// show the same rows.
+	After *QueryPage
+}
+
+// dryRunTarget is the target table of an UPDATE or DELETE split into the
+// parts needed to read its rows.
+type dryRunTarget struct {
+	// relation is the text from the table name up to the alias, e.g.
+	// `ONLY sales.orders AS o`.
+	relation string
+	name     string
+	// ref qualifies the columns of the target table, the alias or the name.
+	ref   string
+	from  string
+	where string
+	// statement is the query without its RETURNING clause.
+	statement string
+	// key holds the quoted primary key columns, empty when there is none.
+	key []string
+}
+
+// primaryKeyQuery returns the quoted primary key columns of a table in key
+// order.
+const primaryKeyQuery = `SELECT quote_ident(a.attname)
+FROM pg_index i
+JOIN pg_attribute a ON a.attrelid = i.indrelid AND a.attnum = ANY (i.indkey)
+WHERE i.indrelid = to_regclass($1) AND i.indisprimary
+ORDER BY array_position(i.indkey::int2[], a.attnum)`
+
+// HandleDryRun executes an UPDATE or DELETE inside a transaction, samples
+// the rows it changes and rolls it back. Inside a session transaction the
+// statement sees the staged changes and is undone with a savepoint.
+func HandleDryRun(ctx context.Context, query, expect, format string, limit int, args ...interface{}) (*DryRunResult, error) {
+	db, err := GetDB(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := CheckQuery(ctx, query, expect, args...); err != nil {
+		return nil, err
+	}
+
+	stx, err := SessionTx(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if stx != nil {
+		return stx.DryRun(ctx, query, expect, format, limit, args...)
+	}
+
+	tx, err := BeginTx(ctx, db, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	return dryRun(ctx, tx, query, expect, format, limit, args...)
+}
+
+func dryRun(ctx context.Context, tx *sqlx.Tx, query, expect, format string, limit int, args ...interface{}) (*DryRunResult, error) {
+	stmts, err := ClassifyStatements(query)
+	if err != nil {
+		return nil, err
+	}
+	stmt := stmts[0]
+
+	result := &DryRunResult{Type: expect}
+	target, ok := parseDryRunTarget(stmt.Text)
+	exec := stmt.Text
+	if ok {
+		if err := tx.SelectContext(ctx, &target.key, primaryKeyQuery, target.name); err != nil {
+			return nil, fmt.Errorf("failed to read the primary key of %s: %v", target.name, err)
+		}
+		exec = target.changeQuery()
+	} else if !stmt.Returning {
+		exec += " RETURNING *"
+	}
+
+	if ok && expect == StatementTypeUpdate {
+		preImage, preArgs := renumberParams(target.preImageQuery(limit), args)
+		if result.Before, err = readRows(ctx, tx, preImage, format, limit, preArgs...); err != nil {
+			return nil, fmt.Errorf("failed to read the rows before the update: %v", err)
+		}
+	}
+
+	changed, err := execReturning(ctx, tx, exec, format, limit, args...)
+	if err != nil {
+		return nil, err
+	}
+	result.RowsAffected = changed.RowsAffected
+	if expect == StatementTypeDelete {
+		result.Before = changed.Page
+	} else {
+		result.After = changed.Page
+	}
+
+	return result, nil
+}
+
+// parseDryRunTarget splits `UPDATE [ONLY] name [[AS] alias] SET ... [FROM
+// ...] [WHERE ...]` and `DELETE FROM [ONLY] name [[AS] alias] [USING ...]
+// [WHERE ...]`. Statements starting with WITH and WHERE CURRENT OF are not
+// supported.
+func parseDryRunTarget(query string) (*dryRunTarget, bool) {
+	tokens, err := tokenize(query)
+	if err != nil || len(tokens) < 2 {
+		return nil, false
+	}
+
+	i := 1
+	switch {
+	case tokens[0].isWord("UPDATE"):
+	case tokens[0].isWord("DELETE") && tokens[1].isWord("FROM"):
+		i = 2
+	default:
+		return nil, false
+	}
+	start := i
+	if i < len(tokens) && tokens[i].isWord("ONLY") {
+		i++
+	}
+
+	nameStart := i
+	if _, next, ok := qualifiedName(query, tokens, i); ok {
+		i = next
+	} else {
+		return nil, false
+	}
+	name := query[tokens[nameStart].start:tokens[i-1].end]
+	ref := name
+	if i < len(tokens) && tokens[i].is(tokenPunct, "*") {
+		i++
+	}
+
+	if i < len(tokens) && tokens[i].isWord("AS") {
+		i++
+	}
+	if i < len(tokens) && (tokens[i].kind == tokenQuotedIdent || tokens[i].kind == tokenWord && !tokens[i].isWord("SET", "USING", "WHERE", "RETURNING")) {
+		ref = query[tokens[i].start:tokens[i].end]
+		i++
+	}
+	target := &dryRunTarget{relation: query[tokens[start].start:tokens[i-1].end], name: name, ref: ref, statement: query}
+
+	// the clauses after the target, on the top level only
+	clauses := map[string]int{}
+	depth := 0
+	for j := i; j < len(tokens); j++ {
+		switch {
+		case tokens[j].is(tokenPunct, "("):
+			depth++
+		case tokens[j].is(tokenPunct, ")"):
+			depth--
+		case tokens[j].isWord("FROM") && tokens[j-1].isWord("DISTINCT"):
+			// IS [NOT] DISTINCT FROM
+		case depth == 0 && tokens[j].isWord("SET", "FROM", "USING", "WHERE", "RETURNING"):
+			if _, ok := clauses[tokens[j].text]; !ok {
+				clauses[tokens[j].text] = j
+			}
+		}
+	}
+
+	clause := func(names ...string) string {
+		for _, name := range names {
+			j, ok := clauses[name]
+			if !ok {
+				continue
+			}
+
+			end := len(tokens)
+			for _, next := range clauses {
+				if next > j && next < end {
+					end = next
+				}
+			}
+			if j+1 >= end {
+				return ""
+			}
+			return query[tokens[j+1].start:tokens[end-1].end]
+		}
+		return ""
+	}
+
+	if set, ok := clauses["SET"]; tokens[0].isWord("UPDATE") && (!ok || set != i) {
+		return nil, false
+	}
+	if j, ok := clauses["RETURNING"]; ok {
+		target.statement = strings.TrimSpace(query[:tokens[j].start])
+	}
+	target.from = clause("FROM", "USING")
+	target.where = clause("WHERE")
+	if strings.HasPrefix(strings.ToUpper(target.where), "CURRENT OF") {
+		return nil, false
+	}
+
+	return target, true
+}
+
+// preImageQuery selects at most limit rows of the target table that the
+// statement is going to change, 0 means no limit.
+func (t *dryRunTarget) preImageQuery(limit int) string {
+	query := "SELECT " + t.ref + ".* FROM " + t.relation
+	if t.from != "" {
+		query += ", " + t.from
+	}
+	if t.where != "" {
+		query += " WHERE " + t.where
+	}
+	if len(t.key) > 0 {
+		query += " ORDER BY " + t.ref + "." + strings.Join(t.key, ", "+t.ref+".")
+	}
+	if limit > 0 {
+		// one more row tells that the sample is truncated
+		query += " LIMIT " + strconv.Itoa(limit+1)
+	}
+
+	return query
+}
+
+// changeQuery returns the statement returning the changed rows of the target
+// table, without the columns of FROM and USING tables and ordered like the
+// pre-image.
+func (t *dryRunTarget) changeQuery() string {
+	query := t.statement + " RETURNING " + t.ref + ".*"
+	if len(t.key) == 0 {
+		return query
+	}
+
+	return "WITH mcp_dry_run AS (" + query + ") SELECT * FROM mcp_dry_run ORDER BY " + strings.Join(t.key, ", ")
+}
+
+// renumberParams rewrites the $n placeholders of query to $1..$m in order of
+// first use and returns the matching subset of args. Postgres rejects a
+// query that leaves a parameter unused, e.g. one only used in the SET clause
+// of the UPDATE the query was derived from.
+func renumberParams(query string, args []interface{}) (string, []interface{}) {
+	tokens, err := tokenize(query)
+	if err != nil {
+		return query, args
+	}
+
+	var b strings.Builder
+	var used []interface{}
+	numbers := map[int]int{}
+	last := 0
+	for _, tok := range tokens {
+		if tok.kind != tokenParam {
+			continue
+		}
+		n, err := strconv.Atoi(tok.text[1:])
+		if err != nil || n < 1 || n > len(args) {
+			return query, args
+		}
+
+		if _, ok := numbers[n]; !ok {
+			used = append(used, args[n-1])
+			numbers[n] = len(used)
+		}
+		b.WriteString(query[last:tok.start])
+		b.WriteString("$" + strconv.Itoa(numbers[n]))
+		last = tok.end
+	}
+	b.WriteString(query[last:])
+
+	return b.String(), used
+}
+
+// DryRun executes an UPDATE or DELETE inside the transaction and undoes it.
+func (s *sessionTx) DryRun(ctx context.Context, query, expect, format string, limit int, args ...interface{}) (*DryRunResult, error) {
+	var result *DryRunResult
+	err := s.run(ctx, func(tx *sqlx.Tx) error {
+		var err error
+		if result, err = dryRun(ctx, tx, query, expect, format, limit, args...); err != nil {
+			return err
+		}
+		_, err = tx.ExecContext(ctx, "ROLLBACK TO SAVEPOINT "+sessionSavepoint)
+		return err
+	})
+
+	return result, err
+}
+
+// Summary reports how many rows the statement would change and whether that
+// exceeds MaxAffectedRows.
+func (r *DryRunResult) Summary() string {
+	summary := fmt.Sprintf("dry run: %d rows would be affected, the changes were rolled back", r.RowsAffected)
+	if MaxAffectedRows > 0 && r.RowsAffected > MaxAffectedRows {
+		summary += fmt.Sprintf("; executing it would fail, as it exceeds the limit of %d rows", MaxAffectedRows)
+	}
+
+	return summary
+}
+
+// ToolResult returns the summary, the before and after samples and the
+// whole result as JSON.
+func (r *DryRunResult) ToolResult() (*mcp.CallToolResult, error) {
+	info := map[string]interface{}{
+		"dry_run":       true,
+		"rows_affected": r.RowsAffected,
+	}
+	content := []mcp.Content{mcp.NewTextContent(r.Summary())}
+
+	before := "before"
+	if r.Type == StatementTypeDelete {
+		before = "deleted"
+	}
+	for _, sample := range []struct {
+		name string
+		page *QueryPage
+	}{{before, r.Before}, {"after", r.After}} {
+		if sample.page == nil {
+			continue
+		}
+		info[sample.name] = NewPageInfo(sample.page)
+		content = append(content, mcp.NewTextContent(fmt.Sprintf("%s (%d rows):\n%s", sample.name, sample.page.RowCount, sample.page.Output)))
+	}
+
+	data, err := json.Marshal(info)
+	if err != nil {
+		return nil, err
+	}
+
+	return &mcp.CallToolResult{Content: append(content, mcp.NewTextContent(string(data)))}, nil
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseDryRunTarget(t *testing.T) {
+	tests := []struct {
+		query    string
+		key      []string
+		name     string
+		preImage string
+		change   string
+	}{
+		{
+			"UPDATE orders SET status = $1 WHERE id = $2",
+			nil,
+			"orders",
+			"SELECT orders.* FROM orders WHERE id = $2 LIMIT 11",
+			"UPDATE orders SET status = $1 WHERE id = $2 RETURNING orders.*",
+		},
+		{
+			`UPDATE ONLY sales."Orders" AS o SET total = o.total * 2 FROM customers c WHERE c.id = o.customer_id AND c.vip IS DISTINCT FROM false RETURNING o.id`,
+			[]string{"region", "id"},
+			`sales."Orders"`,
+			`SELECT o.* FROM ONLY sales."Orders" AS o, customers c WHERE c.id = o.customer_id AND c.vip IS DISTINCT FROM false ORDER BY o.region, o.id LIMIT 11`,
+			`WITH mcp_dry_run AS (UPDATE ONLY sales."Orders" AS o SET total = o.total * 2 FROM customers c WHERE c.id = o.customer_id AND c.vip IS DISTINCT FROM false RETURNING o.*) SELECT * FROM mcp_dry_run ORDER BY region, id`,
+		},
+		{
+			"UPDATE orders SET note = (SELECT name FROM customers WHERE id = 1)",
+			nil,
+			"orders",
+			"SELECT orders.* FROM orders LIMIT 11",
+			"UPDATE orders SET note = (SELECT name FROM customers WHERE id = 1) RETURNING orders.*",
+		},
+		{
+			"DELETE FROM orders o USING customers c WHERE c.id = o.customer_id",
+			[]string{"id"},
+			"orders",
+			"SELECT o.* FROM orders o, customers c WHERE c.id = o.customer_id ORDER BY o.id LIMIT 11",
+			"WITH mcp_dry_run AS (DELETE FROM orders o USING customers c WHERE c.id = o.customer_id RETURNING o.*) SELECT * FROM mcp_dry_run ORDER BY id",
+		},
+	}
+
+	for _, test := range tests {
+		target, ok := parseDryRunTarget(test.query)
+
+		assert.True(t, ok, test.query)
+		target.key = test.key
+		assert.Equal(t, test.name, target.name, test.query)
+		assert.Equal(t, test.preImage, target.preImageQuery(10), test.query)
+		assert.Equal(t, test.change, target.changeQuery(), test.query)
+	}
+
+	for _, query := range []string{
+		"WITH x AS (SELECT 1) UPDATE orders SET status = 'x'",
+		"UPDATE orders SET status = 'x' WHERE CURRENT OF c",
+		"DELETE orders",
+	} {
+		_, ok := parseDryRunTarget(query)
+		assert.False(t, ok, query)
+	}
+}
+
+func TestRenumberParams(t *testing.T) {
+	query, args := renumberParams("SELECT * FROM orders WHERE id = $3 OR parent_id = $3 OR note = '$1' OR status = $2", []interface{}{"paid", "new", int64(7)})
+
+	assert.Equal(t, "SELECT * FROM orders WHERE id = $1 OR parent_id = $1 OR note = '$1' OR status = $2", query)
+	assert.Equal(t, []interface{}{int64(7), "new"}, args)
+}
+
+func TestHandleDryRun(t *testing.T) {
+	_, mock, cleanup := setupMockDB(t)
+	defer cleanup()
+
+	t.Run("update", func(t *testing.T) {
+		// Setup mock expectations
+		expectTx(mock)
+		mock.ExpectQuery("pg_index").WithArgs("orders").
+			WillReturnRows(sqlmock.NewRows([]string{"quote_ident"}).AddRow("id"))
+		mock.ExpectQuery(`SELECT orders\.\* FROM orders WHERE id < \$1 ORDER BY orders\.id LIMIT 3`).WithArgs(int64(10)).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "status"}).AddRow(1, "new").AddRow(2, "new"))
+		mock.ExpectQuery(`WITH mcp_dry_run AS \(UPDATE orders SET status = \$1 WHERE id < \$2 RETURNING orders\.\*\) SELECT \* FROM mcp_dry_run ORDER BY id`).WithArgs("paid", int64(10)).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "status"}).AddRow(1, "paid").AddRow(2, "paid"))
+		mock.ExpectRollback()
+
+		// Call HandleDryRun
+		result, err := HandleDryRun(context.Background(), "UPDATE orders SET status = $1 WHERE id < $2;", StatementTypeUpdate, FormatCSV, 2, "paid", int64(10))
+
+		// Verify results
+		assert.NoError(t, err)
+		assert.Equal(t, int64(2), result.RowsAffected)
+		assert.Equal(t, "id,status\n1,new\n2,new\n", result.Before.Output)
+		assert.Equal(t, "id,status\n1,paid\n2,paid\n", result.After.Output)
+		assert.NoError(t, mock.ExpectationsWereMet())
+
+		toolResult, err := result.ToolResult()
+		assert.NoError(t, err)
+		assert.Len(t, toolResult.Content, 4)
+		assert.Equal(t, "dry run: 2 rows would be affected, the changes were rolled back", toolResult.Content[0].(mcp.TextContent).Text)
+		assert.Equal(t, "before (2 rows):\nid,status\n1,new\n2,new\n", toolResult.Content[1].(mcp.TextContent).Text)
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		// Setup mock expectations
+		expectTx(mock)
+		mock.ExpectQuery("pg_index").WithArgs("orders").
+			WillReturnRows(sqlmock.NewRows([]string{"quote_ident"}))
+		mock.ExpectQuery(`DELETE FROM orders WHERE status = 'cancelled' RETURNING orders\.\*`).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "status"}).AddRow(3, "cancelled").AddRow(4, "cancelled").AddRow(5, "cancelled"))
+		mock.ExpectRollback()
+
+		// Call HandleDryRun
+		result, err := HandleDryRun(context.Background(), "DELETE FROM orders WHERE status = 'cancelled'", StatementTypeDelete, FormatCSV, 2)
+
+		// Verify results
+		assert.NoError(t, err)
+		assert.Equal(t, int64(3), result.RowsAffected)
+		assert.Equal(t, "id,status\n3,cancelled\n4,cancelled\n", result.Before.Output)
+		assert.True(t, result.Before.Truncated)
+		assert.Nil(t, result.After)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
@@ -0,0 +1,329 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// MaxOutputBytes caps the encoded size of a single result, 0 disables the cap.
+var MaxOutputBytes int
+
+// Output formats of query results.
+const (
+	FormatCSV      = "csv"
+	FormatJSON     = "json"
+	FormatNDJSON   = "ndjson"
+	FormatMarkdown = "markdown"
+)
+
+// ParseFormat validates the format argument of a tool, csv is the default.
+func ParseFormat(raw interface{}) (string, error) {
+	format, _ := raw.(string)
+	switch strings.ToLower(format) {
+	case "", FormatCSV:
+		return FormatCSV, nil
+	case FormatJSON:
+		return FormatJSON, nil
+	case FormatNDJSON:
+		return FormatNDJSON, nil
+	case FormatMarkdown:
+		return FormatMarkdown, nil
+	}
+
+	return "", fmt.Errorf("unsupported format %q, expected csv, json, ndjson or markdown", format)
+}
+
+// RowEncoder writes query results to its output as the rows are scanned.
+// Every call writes through to the output, nothing is buffered.
+type RowEncoder interface {
+	WriteHeader(cols []Column) error
+	WriteRow(values []interface{}) error
+	// Close writes the end of the document, if the format has one.
+	Close() error
+}
+
+// NewRowEncoder returns the RowEncoder for format, and the number of bytes
+// its Close writes.
+func NewRowEncoder(format string, w io.Writer) (RowEncoder, int) {
+	switch format {
+	case FormatJSON:
+		return &jsonEncoder{w: w, array: true}, len("\n]\n")
+	case FormatNDJSON:
+		return &jsonEncoder{w: w}, 0
+	case FormatMarkdown:
+		return &markdownEncoder{w: w}, 0
+	default:
+		return NewCSVEncoder(w), 0
+	}
+}
+
+type csvEncoder struct {
+	w      *csv.Writer
+	cols   []Column
+	record []string
+}
+
+// NewCSVEncoder returns a RowEncoder writing CSV with a header line. NULL is
+// written as an empty field.
+func NewCSVEncoder(w io.Writer) RowEncoder {
+	return &csvEncoder{w: csv.NewWriter(w)}
+}
+
+func (e *csvEncoder) WriteHeader(cols []Column) error {
+	e.cols = cols
+	e.record = make([]string, len(cols))
+	if err := e.w.Write(ColumnNames(cols)); err != nil {
+		return fmt.Errorf("failed to write headers: %v", err)
+	}
+
+	return e.flush()
+}
+
+func (e *csvEncoder) WriteRow(values []interface{}) error {
+	for i, value := range values {
+		e.record[i], _ = TextValue(e.cols[i], value)
+	}
+	if err := e.w.Write(e.record); err != nil {
+		return fmt.Errorf("failed to write row: %v", err)
+	}
+
+	return e.flush()
+}
+
+func (e *csvEncoder) Close() error {
+	return nil
+}
+
+func (e *csvEncoder) flush() error {
+	e.w.Flush()
+	if err := e.w.Error(); err != nil {
+		return fmt.Errorf("error flushing CSV writer: %v", err)
+	}
+
+	return nil
+}
+
+// jsonEncoder writes one object per row, keyed by column name in column
+// order. As an array for json, or one object per line for ndjson.
+type jsonEncoder struct {
+	w     io.Writer
+	cols  []Column
+	keys  [][]byte
+	array bool
+	rows  int
+}
+
+func (e *jsonEncoder) WriteHeader(cols []Column) error {
+	e.cols = cols
+	e.keys = make([][]byte, len(cols))
+	for i, col := range cols {
+		key, err := json.Marshal(col.Name)
+		if err != nil {
+			return err
+		}
+		e.keys[i] = key
+	}
+
+	return nil
+}
+
+func (e *jsonEncoder) WriteRow(values []interface{}) error {
+	var b bytes.Buffer
+	switch {
+	case !e.array:
+	case e.rows == 0:
+		b.WriteString("[\n")
+	default:
+		b.WriteString(",\n")
+	}
+
+	b.WriteByte('{')
+	for i, value := range values {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.Write(e.keys[i])
+		b.WriteByte(':')
+
+		data, err := json.Marshal(JSONValue(e.cols[i], value))
+		if err != nil {
+			return fmt.Errorf("failed to write column %s: %v", e.cols[i].Name, err)
+		}
+		b.Write(data)
+	}
+	b.WriteByte('}')
+	if !e.array {
+		b.WriteByte('\n')
+	}
+
+	e.rows++
+	_, err := e.w.Write(b.Bytes())
+	return err
+}
+
+func (e *jsonEncoder) Close() error {
+	if !e.array {
+		return nil
+	}
+
+	trailer := "\n]\n"
+	if e.rows == 0 {
+		trailer = "[]\n"
+	}
+	_, err := io.WriteString(e.w, trailer)
+	return err
+}
+
+// markdownEncoder writes a GitHub flavored Markdown table, NULL is written
+// as NULL.
+type markdownEncoder struct {
+	w    io.Writer
+	cols []Column
+}
+
+var markdownEscaper = strings.NewReplacer("|", "\\|", "\r\n", "<br>", "\n", "<br>", "\r", "")
+
+func (e *markdownEncoder) WriteHeader(cols []Column) error {
+	e.cols = cols
+
+	var b strings.Builder
+	b.WriteString("|")
+	for _, col := range cols {
+		b.WriteString(" " + markdownEscaper.Replace(col.Name) + " |")
+	}
+	b.WriteString("\n|")
+	for range cols {
+		b.WriteString(" --- |")
+	}
+	b.WriteString("\n")
+
+	_, err := io.WriteString(e.w, b.String())
+	return err
+}
+
+func (e *markdownEncoder) WriteRow(values []interface{}) error {
+	var b strings.Builder
+	b.WriteString("|")
+	for i, value := range values {
+		text, ok := TextValue(e.cols[i], value)
+		if !ok {
+			text = "NULL"
+		}
+		b.WriteString(" " + markdownEscaper.Replace(text) + " |")
+	}
+	b.WriteString("\n")
+
+	_, err := io.WriteString(e.w, b.String())
+	return err
+}
+
+func (e *markdownEncoder) Close() error {
+	return nil
+}
+
+// PageWriter encodes rows into memory until the row limit or the
+// --max-output-bytes budget is reached. A row that does not fit is cut off
+// entirely, so the output always ends at a row boundary.
+type PageWriter struct {
+	buf   bytes.Buffer
+	enc   RowEncoder
+	limit int
+	max   int
+	// Rows is the number of rows written so far.
+	Rows int
+}
+
+// NewPageWriter returns a PageWriter encoding format for at most limit rows,
+// 0 means no row limit.
+func NewPageWriter(format string, limit int) *PageWriter {
+	p := &PageWriter{limit: limit, max: MaxOutputBytes}
+
+	var reserve int
+	p.enc, reserve = NewRowEncoder(format, &p.buf)
+	if p.max > 0 {
+		// keep room for the end of the document
+		p.max -= reserve
+	}
+
+	return p
+}
+
+func (p *PageWriter) WriteHeader(cols []Column) error {
+	return p.enc.WriteHeader(cols)
+}
+
+// WriteRow encodes values and reports whether they fit into the page.
+func (p *PageWriter) WriteRow(values []interface{}) (bool, error) {
+	if p.limit > 0 && p.Rows >= p.limit {
+		return false, nil
+	}
+
+	mark := p.buf.Len()
+	if err := p.enc.WriteRow(values); err != nil {
+		return false, err
+	}
+
+	if p.max > 0 && p.buf.Len() > p.max {
+		p.buf.Truncate(mark)
+		if p.Rows == 0 {
+			return false, fmt.Errorf("a single row does not fit into the output limit of %d bytes, raise --max-output-bytes", MaxOutputBytes)
+		}
+		return false, nil
+	}
+
+	p.Rows++
+	return true, nil
+}
+
+// WriteRows streams rows into the page until they run out or the page is
+// full. It returns the first row that did not fit, nil when all rows were
+// written.
+func (p *PageWriter) WriteRows(rows *sqlx.Rows) ([]interface{}, error) {
+	for rows.Next() {
+		values, err := ScanValues(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		ok, err := p.WriteRow(values)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			return values, nil
+		}
+	}
+
+	return nil, rows.Err()
+}
+
+// Close ends the document and returns the encoded page.
+func (p *PageWriter) Close() (string, error) {
+	if err := p.enc.Close(); err != nil {
+		return "", err
+	}
+
+	return p.buf.String(), nil
+}
+
+// ScanValues scans the current row, returning text columns as strings.
+func ScanValues(rows *sqlx.Rows) ([]interface{}, error) {
+	values, err := rows.SliceScan()
+	if err != nil {
+		return nil, err
+	}
+
+	for i, v := range values {
+		if b, ok := v.([]byte); ok {
+			values[i] = string(b)
+		}
+	}
+
+	return values, nil
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPageWriter(t *testing.T) {
+	maxOutputBytes := MaxOutputBytes
+	defer func() { MaxOutputBytes = maxOutputBytes }()
+
+	t.Run("row limit", func(t *testing.T) {
+		MaxOutputBytes = 0
+		p := NewPageWriter(FormatCSV, 2)
+
+		assert.NoError(t, p.WriteHeader([]Column{{Name: "id"}, {Name: "name"}}))
+		for i, want := range []bool{true, true, false} {
+			ok, err := p.WriteRow([]interface{}{int64(i), "a,b"})
+			assert.NoError(t, err)
+			assert.Equal(t, want, ok)
+		}
+
+		output, err := p.Close()
+		assert.NoError(t, err)
+		assert.Equal(t, 2, p.Rows)
+		assert.Equal(t, "id,name\n0,\"a,b\"\n1,\"a,b\"\n", output)
+	})
+
+	t.Run("byte budget", func(t *testing.T) {
+		MaxOutputBytes = 12
+		p := NewPageWriter(FormatCSV, 0)
+
+		assert.NoError(t, p.WriteHeader([]Column{{Name: "id"}}))
+		ok, err := p.WriteRow([]interface{}{int64(12345)})
+		assert.NoError(t, err)
+		assert.True(t, ok)
+
+		ok, err = p.WriteRow([]interface{}{int64(67890)})
+		assert.NoError(t, err)
+		assert.False(t, ok)
+
+		output, err := p.Close()
+		assert.NoError(t, err)
+		assert.Equal(t, 1, p.Rows)
+		assert.Equal(t, "id\n12345\n", output)
+	})
+
+	t.Run("byte budget keeps room for the json trailer", func(t *testing.T) {
+		MaxOutputBytes = len("[\n{\"id\":1}\n]\n")
+		p := NewPageWriter(FormatJSON, 0)
+
+		assert.NoError(t, p.WriteHeader([]Column{{Name: "id"}}))
+		ok, err := p.WriteRow([]interface{}{int64(1)})
+		assert.NoError(t, err)
+		assert.True(t, ok)
+
+		ok, err = p.WriteRow([]interface{}{int64(2)})
+		assert.NoError(t, err)
+		assert.False(t, ok)
+
+		output, err := p.Close()
+		assert.NoError(t, err)
+		assert.Equal(t, "[\n{\"id\":1}\n]\n", output)
+	})
+
+	t.Run("first row larger than the budget", func(t *testing.T) {
+		MaxOutputBytes = 4
+		p := NewPageWriter(FormatCSV, 0)
+
+		assert.NoError(t, p.WriteHeader([]Column{{Name: "id"}}))
+		_, err := p.WriteRow([]interface{}{"too long"})
+
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "output limit of 4 bytes")
+	})
+}
+
+func TestRowEncoders(t *testing.T) {
+	maxOutputBytes := MaxOutputBytes
+	defer func() { MaxOutputBytes = maxOutputBytes }()
+	MaxOutputBytes = 0
+
+	cols := []Column{
+		{Name: "id", Type: "int8"},
+		{Name: "note", Type: "text"},
+		{Name: "price", Type: "numeric"},
+		{Name: "tags", Type: "_text"},
+		{Name: "data", Type: "jsonb"},
+		{Name: "created_at", Type: "timestamptz"},
+	}
+	rows := [][]interface{}{
+		{int64(1), "a|b", "10.50", `{x,"y z",NULL}`, `{"k": [1, 2]}`, time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)},
+		{int64(2), nil, nil, nil, nil, nil},
+	}
+
+	encode := func(format string) string {
+		p := NewPageWriter(format, 0)
+		assert.NoError(t, p.WriteHeader(cols))
+		for _, row := range rows {
+			_, err := p.WriteRow(row)
+			assert.NoError(t, err)
+		}
+
+		output, err := p.Close()
+		assert.NoError(t, err)
+		return output
+	}
+
+	t.Run("csv", func(t *testing.T) {
+		assert.Equal(t, "id,note,price,tags,data,created_at\n"+
+			"1,a|b,10.50,\"{x,\"\"y z\"\",NULL}\",\"{\"\"k\"\": [1, 2]}\",2024-01-02 03:04:05+00:00\n"+
+			"2,,,,,\n", encode(FormatCSV))
+	})
+
+	t.Run("json", func(t *testing.T) {
+		assert.Equal(t, "[\n"+
+			`{"id":1,"note":"a|b","price":10.50,"tags":["x","y z",null],"data":{"k":[1,2]},"created_at":"2024-01-02T03:04:05Z"}`+",\n"+
+			`{"id":2,"note":null,"price":null,"tags":null,"data":null,"created_at":null}`+"\n]\n", encode(FormatJSON))
+	})
+
+	t.Run("ndjson", func(t *testing.T) {
+		assert.Equal(t,
+			`{"id":1,"note":"a|b","price":10.50,"tags":["x","y z",null],"data":{"k":[1,2]},"created_at":"2024-01-02T03:04:05Z"}`+"\n"+
+				`{"id":2,"note":null,"price":null,"tags":null,"data":null,"created_at":null}`+"\n", encode(FormatNDJSON))
+	})
+
+	t.Run("markdown", func(t *testing.T) {
+		assert.Equal(t, "| id | note | price | tags | data | created_at |\n"+
+			"| --- | --- | --- | --- | --- | --- |\n"+
+			`| 1 | a\|b | 10.50 | {x,"y z",NULL} | {"k": [1, 2]} | 2024-01-02 03:04:05+00:00 |`+"\n"+
+			"| 2 | NULL | NULL | NULL | NULL | NULL |\n", encode(FormatMarkdown))
+	})
+
+	t.Run("empty json result", func(t *testing.T) {
+		p := NewPageWriter(FormatJSON, 0)
+		assert.NoError(t, p.WriteHeader(cols))
+
+		output, err := p.Close()
+		assert.NoError(t, err)
+		assert.Equal(t, "[]\n", output)
+	})
+}
+
+func TestParseFormat(t *testing.T) {
+	format, err := ParseFormat(nil)
+	assert.NoError(t, err)
+	assert.Equal(t, FormatCSV, format)
+
+	format, err = ParseFormat("Markdown")
+	assert.NoError(t, err)
+	assert.Equal(t, FormatMarkdown, format)
+
+	_, err = ParseFormat("xml")
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), `unsupported format "xml"`)
+}
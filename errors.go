@@ -0,0 +1,113 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// ToolError is the structured form of a failed tool call.
+type ToolError struct {
+	Message    string `json:"message"`
+	Severity   string `json:"severity,omitempty"`
+	Code       string `json:"sqlstate,omitempty"`
+	Detail     string `json:"detail,omitempty"`
+	Hint       string `json:"hint,omitempty"`
+	Position   int32  `json:"position,omitempty"`
+	Where      string `json:"where,omitempty"`
+	Schema     string `json:"schema,omitempty"`
+	Table      string `json:"table,omitempty"`
+	Column     string `json:"column,omitempty"`
+	DataType   string `json:"data_type,omitempty"`
+	Constraint string `json:"constraint,omitempty"`
+	// RowsAffected is the number of rows a statement rolled back by
+	// --max-affected-rows would have changed.
+	RowsAffected int64 `json:"rows_affected,omitempty"`
+}
+
+// NewToolError extracts the server reported fields from database errors.
+func NewToolError(err error) *ToolError {
+	var rowsErr *AffectedRowsError
+	if errors.As(err, &rowsErr) {
+		return &ToolError{Message: err.Error(), RowsAffected: rowsErr.RowsAffected}
+	}
+
+	var pgErr *pgconn.PgError
+	if !errors.As(err, &pgErr) {
+		return &ToolError{Message: err.Error()}
+	}
+
+	return &ToolError{
+		Message:    pgErr.Message,
+		Severity:   pgErr.Severity,
+		Code:       pgErr.Code,
+		Detail:     pgErr.Detail,
+		Hint:       pgErr.Hint,
+		Position:   pgErr.Position,
+		Where:      pgErr.Where,
+		Schema:     pgErr.SchemaName,
+		Table:      pgErr.TableName,
+		Column:     pgErr.ColumnName,
+		DataType:   pgErr.DataTypeName,
+		Constraint: pgErr.ConstraintName,
+	}
+}
+
+// Text renders the error as localized lines for the model to read.
+func (e *ToolError) Text() string {
+	data := map[string]interface{}{
+		"Message":    e.Message,
+		"Code":       e.Code,
+		"Detail":     e.Detail,
+		"Hint":       e.Hint,
+		"Position":   e.Position,
+		"Table":      e.Table,
+		"Column":     e.Column,
+		"Constraint": e.Constraint,
+	}
+
+	if e.Code == "" {
+		return TData("error.failed", data)
+	}
+
+	lines := []string{TData("error.database", data)}
+	if e.Detail != "" {
+		lines = append(lines, TData("error.detail", data))
+	}
+	if e.Hint != "" {
+		lines = append(lines, TData("error.hint", data))
+	}
+	if e.Position > 0 {
+		lines = append(lines, TData("error.position", data))
+	}
+	if e.Constraint != "" {
+		lines = append(lines, TData("error.constraint", data))
+	}
+	if e.Table != "" {
+		lines = append(lines, TData("error.table", data))
+	}
+	if e.Column != "" {
+		lines = append(lines, TData("error.column", data))
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// ErrorResult converts err into an IsError tool result. The first content is
+// the localized message, the second one the same error as JSON.
+func ErrorResult(err error) *mcp.CallToolResult {
+	toolErr := NewToolError(err)
+
+	content := []mcp.Content{mcp.NewTextContent(toolErr.Text())}
+	if data, err := json.Marshal(map[string]interface{}{"error": toolErr}); err == nil {
+		content = append(content, mcp.NewTextContent(string(data)))
+	}
+
+	return &mcp.CallToolResult{
+		Content: content,
+		IsError: true,
+	}
+}
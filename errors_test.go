@@ -0,0 +1,79 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestErrorResult(t *testing.T) {
+	t.Run("database error", func(t *testing.T) {
+		// Setup test data
+		err := fmt.Errorf("insert failed: %w", &pgconn.PgError{
+			Severity:       "ERROR",
+			Code:           "23505",
+			Message:        `duplicate key value violates unique constraint "users_pkey"`,
+			Detail:         "Key (id)=(1) already exists.",
+			SchemaName:     "public",
+			TableName:      "users",
+			ConstraintName: "users_pkey",
+		})
+
+		// Call ErrorResult
+		result := ErrorResult(err)
+
+		// Verify results
+		assert.True(t, result.IsError)
+		assert.Len(t, result.Content, 2)
+
+		text := result.Content[0].(mcp.TextContent).Text
+		assert.Contains(t, text, `Database error (SQLSTATE 23505): duplicate key value violates unique constraint "users_pkey"`)
+		assert.Contains(t, text, "Detail: Key (id)=(1) already exists.")
+		assert.Contains(t, text, "Constraint: users_pkey")
+		assert.Contains(t, text, "Table: users")
+		assert.NotContains(t, text, "Hint:")
+
+		structured := map[string]map[string]interface{}{}
+		assert.NoError(t, json.Unmarshal([]byte(result.Content[1].(mcp.TextContent).Text), &structured))
+		assert.Equal(t, "23505", structured["error"]["sqlstate"])
+		assert.Equal(t, "users_pkey", structured["error"]["constraint"])
+		assert.Equal(t, "public", structured["error"]["schema"])
+		assert.NotContains(t, structured["error"], "hint")
+	})
+
+	t.Run("syntax error position", func(t *testing.T) {
+		// Call ErrorResult
+		result := ErrorResult(&pgconn.PgError{Severity: "ERROR", Code: "42601", Message: `syntax error at or near "FORM"`, Position: 10})
+
+		// Verify results
+		text := result.Content[0].(mcp.TextContent).Text
+		assert.Contains(t, text, "Position: 10")
+	})
+
+	t.Run("other error", func(t *testing.T) {
+		// Call ErrorResult
+		result := ErrorResult(fmt.Errorf("multiple statements are not allowed, found 2, denied"))
+
+		// Verify results
+		assert.True(t, result.IsError)
+		assert.Equal(t, "Tool execution failed: multiple statements are not allowed, found 2, denied", result.Content[0].(mcp.TextContent).Text)
+		assert.JSONEq(t, `{"error": {"message": "multiple statements are not allowed, found 2, denied"}}`, result.Content[1].(mcp.TextContent).Text)
+	})
+
+	t.Run("localized", func(t *testing.T) {
+		// Switch to Chinese messages
+		originalLocalizer := Localizer
+		Localizer = NewLocalizer("zh-CN")
+		defer func() { Localizer = originalLocalizer }()
+
+		// Call ErrorResult
+		result := ErrorResult(&pgconn.PgError{Severity: "ERROR", Code: "42P01", Message: `relation "nope" does not exist`})
+
+		// Verify results
+		assert.Equal(t, `数据库错误 (SQLSTATE 42P01): relation "nope" does not exist`, result.Content[0].(mcp.TextContent).Text)
+	})
+}
@@ -0,0 +1,272 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// PlanNode is a single node of the plan tree returned by `EXPLAIN (FORMAT JSON)`.
+type PlanNode struct {
+	NodeType           string     `json:"Node Type"`
+	Operation          string     `json:"Operation,omitempty"`
+	ParentRelationship string     `json:"Parent Relationship,omitempty"`
+	RelationName       string     `json:"Relation Name,omitempty"`
+	Schema             string     `json:"Schema,omitempty"`
+	Alias              string     `json:"Alias,omitempty"`
+	StartupCost        float64    `json:"Startup Cost"`
+	TotalCost          float64    `json:"Total Cost"`
+	PlanRows           float64    `json:"Plan Rows"`
+	PlanWidth          int        `json:"Plan Width"`
+	Plans              []PlanNode `json:"Plans,omitempty"`
+}
+
+// ExplainOutput is one element of the JSON array returned by `EXPLAIN (FORMAT JSON)`.
+type ExplainOutput struct {
+	Plan PlanNode `json:"Plan"`
+}
+
+// StatementType maps the node to one of the StatementType* constants. Only
+// ModifyTable nodes write data, every other node type is a read.
+func (n *PlanNode) StatementType() string {
+	if n.NodeType == "ModifyTable" {
+		return strings.ToUpper(n.Operation)
+	}
+
+	return StatementTypeSelect
+}
+
+// Walk calls fn for the node and all of its descendants, depth first.
+func (n *PlanNode) Walk(fn func(node *PlanNode)) {
+	fn(n)
+	for i := range n.Plans {
+		n.Plans[i].Walk(fn)
+	}
+}
+
+// Describe returns a short human readable label such as `Seq Scan on users`.
+func (n *PlanNode) Describe() string {
+	label := n.NodeType
+	if n.Operation != "" && n.NodeType == "ModifyTable" {
+		label = n.Operation
+	}
+	if n.RelationName != "" {
+		label += " on " + n.QualifiedRelationName()
+	}
+
+	return label
+}
+
+// Text renders the plan tree indented like the text format of EXPLAIN, e.g.
+// `Update on public.users  (cost=0.00..35.50 rows=0)`.
+func (n *PlanNode) Text() string {
+	var b strings.Builder
+	n.writeText(&b, 0)
+
+	return strings.TrimSuffix(b.String(), "\n")
+}
+
+func (n *PlanNode) writeText(b *strings.Builder, depth int) {
+	if depth > 0 {
+		b.WriteString(strings.Repeat("      ", depth-1) + "  ->  ")
+	}
+	fmt.Fprintf(b, "%s  (cost=%.2f..%.2f rows=%.0f)\n", n.Describe(), n.StartupCost, n.TotalCost, n.PlanRows)
+	for i := range n.Plans {
+		n.Plans[i].writeText(b, depth+1)
+	}
+}
+
+// QualifiedRelationName returns `schema.relation` when the plan was produced
+// with VERBOSE, or just the relation name otherwise.
+func (n *PlanNode) QualifiedRelationName() string {
+	if n.Schema != "" {
+		return n.Schema + "." + n.RelationName
+	}
+
+	return n.RelationName
+}
+
+func ParseExplainJSON(data []byte) (*PlanNode, error) {
+	result := []ExplainOutput{}
+	if err := json.Unmarshal(data, &result); err != nil {
+		return nil, fmt.Errorf("failed to parse query plan: %v", err)
+	}
+
+	if len(result) != 1 {
+		return nil, fmt.Errorf("unable to check query plan, denied")
+	}
+
+	return &result[0].Plan, nil
+}
+
+// ExplainQuery returns the plan of a query, see ExplainJSON.
+func ExplainQuery(ctx context.Context, query string, args ...interface{}) (*PlanNode, error) {
+	data, err := ExplainJSON(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	return ParseExplainJSON(data)
+}
+
+// ExplainJSON returns the verbose JSON plan of a query, estimated inside a
+// read-only transaction with the per-call timeouts applied.
+func ExplainJSON(ctx context.Context, query string, args ...interface{}) ([]byte, error) {
+	db, err := GetDB(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := BeginReadOnly(ctx, db)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var data []byte
+	err = tx.QueryRowxContext(ctx, fmt.Sprintf("EXPLAIN (FORMAT JSON, VERBOSE) %s", query), args...).Scan(&data)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("unable to check query plan, denied")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return data, nil
+}
+
+// CheckPlanStatementType verifies that the top node of the plan performs the
+// expected kind of statement and that no other node in the tree modifies data
+// in a different way, e.g. a data-modifying CTE hidden inside a SELECT.
+func CheckPlanStatementType(plan *PlanNode, expect string) error {
+	if got := plan.StatementType(); got != expect {
+		return fmt.Errorf("query plan does not match expected pattern: expected %s, plan performs %s, denied", expect, got)
+	}
+
+	var mismatch *PlanNode
+	plan.Walk(func(node *PlanNode) {
+		if mismatch == nil && node.NodeType == "ModifyTable" && node.StatementType() != expect {
+			mismatch = node
+		}
+	})
+	if mismatch != nil {
+		return fmt.Errorf("query plan does not match expected pattern: expected %s, plan contains %s, denied", expect, mismatch.Describe())
+	}
+
+	return nil
+}
+
+// PlanLimitsEnabled reports whether any of the read_query plan guardrails is configured.
+func PlanLimitsEnabled() bool {
+	return MaxPlanCost > 0 || MaxPlanRows > 0 || MaxSeqScanRows > 0 || MaxNestedLoopRows > 0
+}
+
+// CheckPlanLimits rejects plans that exceed the configured cost and row
+// guardrails. The error names the offending plan node and the limit it
+// tripped, so that the caller can rewrite the query.
+func CheckPlanLimits(ctx context.Context, plan *PlanNode) error {
+	if MaxPlanCost > 0 && plan.TotalCost > MaxPlanCost {
+		return fmt.Errorf("query plan rejected: %s has an estimated total cost of %.2f, above the --max-plan-cost limit of %.2f; add selective WHERE conditions, use indexed columns or add a LIMIT",
+			plan.Describe(), plan.TotalCost, MaxPlanCost)
+	}
+
+	if MaxPlanRows > 0 && plan.PlanRows > MaxPlanRows {
+		return fmt.Errorf("query plan rejected: %s is estimated to return %.0f rows, above the --max-plan-rows limit of %.0f; add a LIMIT or aggregate the result",
+			plan.Describe(), plan.PlanRows, MaxPlanRows)
+	}
+
+	var rejected error
+	plan.Walk(func(node *PlanNode) {
+		if rejected != nil {
+			return
+		}
+
+		switch node.NodeType {
+		case "Seq Scan":
+			if MaxSeqScanRows <= 0 {
+				return
+			}
+
+			rows, err := EstimateTableRows(ctx, node)
+			if err != nil {
+				rejected = err
+				return
+			}
+			if rows > MaxSeqScanRows {
+				rejected = fmt.Errorf("query plan rejected: %s reads the whole table, estimated at %.0f rows, above the --max-seq-scan-rows limit of %.0f; filter on an indexed column or add a LIMIT",
+					node.Describe(), rows, MaxSeqScanRows)
+			}
+		case "Nested Loop":
+			if MaxNestedLoopRows <= 0 || len(node.Plans) == 0 {
+				return
+			}
+
+			outer := &node.Plans[0]
+			if outer.PlanRows > MaxNestedLoopRows {
+				rejected = fmt.Errorf("query plan rejected: Nested Loop iterates over an estimated %.0f rows from %s, above the --max-nested-loop-rows limit of %.0f; join on indexed columns or reduce the outer input",
+					outer.PlanRows, outer.Describe(), MaxNestedLoopRows)
+			}
+		}
+	})
+
+	return rejected
+}
+
+// EstimateTableRows returns pg_class.reltuples for the relation scanned by the
+// node. Tables that have never been analyzed fall back to the plan estimate.
+func EstimateTableRows(ctx context.Context, node *PlanNode) (float64, error) {
+	db, err := GetDB(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	var reltuples float64
+	err = db.QueryRowxContext(ctx, `SELECT c.reltuples
+FROM pg_catalog.pg_class c
+JOIN pg_catalog.pg_namespace n ON n.oid = c.relnamespace
+WHERE n.nspname = $1 AND c.relname = $2`, node.Schema, node.RelationName).Scan(&reltuples)
+	if err == sql.ErrNoRows || (err == nil && reltuples < 0) {
+		return node.PlanRows, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	return reltuples, nil
+}
+
+func HandleExplain(ctx context.Context, query, expect string, args ...interface{}) error {
+	if expect == StatementTypeCreate || expect == StatementTypeAlter {
+		// utility statements have no query plan
+		return nil
+	}
+
+	checkLimits := expect == StatementTypeSelect && PlanLimitsEnabled()
+	if !WithExplainCheck && !checkLimits {
+		return nil
+	}
+
+	target := ExplainTarget(query)
+	if target == "" {
+		return nil
+	}
+
+	plan, err := ExplainQuery(ctx, target, args...)
+	if err != nil {
+		return err
+	}
+
+	if WithExplainCheck {
+		if err := CheckPlanStatementType(plan, expect); err != nil {
+			return err
+		}
+	}
+
+	if checkLimits {
+		return CheckPlanLimits(ctx, plan)
+	}
+
+	return nil
+}
@@ -0,0 +1,287 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseExplainJSON(t *testing.T) {
+	t.Run("nested plan", func(t *testing.T) {
+		// Setup test data
+		data := []byte(`[{"Plan": {"Node Type": "Hash Join", "Total Cost": 51.5, "Plan Rows": 100, "Plans": [
+			{"Node Type": "Seq Scan", "Parent Relationship": "Outer", "Relation Name": "orders", "Total Cost": 30.0, "Plan Rows": 100},
+			{"Node Type": "Hash", "Parent Relationship": "Inner", "Total Cost": 20.0, "Plan Rows": 50, "Plans": [
+				{"Node Type": "Index Scan", "Parent Relationship": "Outer", "Relation Name": "users", "Total Cost": 20.0, "Plan Rows": 50}
+			]}
+		]}}]`)
+
+		// Call ParseExplainJSON
+		plan, err := ParseExplainJSON(data)
+
+		// Verify results
+		assert.NoError(t, err)
+		assert.Equal(t, "Hash Join", plan.NodeType)
+		assert.Equal(t, StatementTypeSelect, plan.StatementType())
+
+		nodes := []string{}
+		plan.Walk(func(node *PlanNode) {
+			nodes = append(nodes, node.Describe())
+		})
+		assert.Equal(t, []string{"Hash Join", "Seq Scan on orders", "Hash", "Index Scan on users"}, nodes)
+	})
+
+	t.Run("invalid json", func(t *testing.T) {
+		// Call ParseExplainJSON
+		_, err := ParseExplainJSON([]byte("Seq Scan on users"))
+
+		// Verify results
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "failed to parse query plan")
+	})
+
+	t.Run("empty plan list", func(t *testing.T) {
+		// Call ParseExplainJSON
+		_, err := ParseExplainJSON([]byte("[]"))
+
+		// Verify results
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "unable to check query plan")
+	})
+}
+
+func TestCheckPlanStatementType(t *testing.T) {
+	t.Run("modify table matches expectation", func(t *testing.T) {
+		plan := &PlanNode{NodeType: "ModifyTable", Operation: "Update", RelationName: "users"}
+
+		assert.NoError(t, CheckPlanStatementType(plan, StatementTypeUpdate))
+		assert.Error(t, CheckPlanStatementType(plan, StatementTypeDelete))
+		assert.Error(t, CheckPlanStatementType(plan, StatementTypeSelect))
+	})
+
+	t.Run("read plan rejected for write expectation", func(t *testing.T) {
+		plan := &PlanNode{NodeType: "Seq Scan", RelationName: "users"}
+
+		err := CheckPlanStatementType(plan, StatementTypeInsert)
+
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "expected INSERT, plan performs SELECT")
+	})
+
+	t.Run("data-modifying CTE inside select", func(t *testing.T) {
+		// WITH d AS (DELETE FROM users RETURNING *) SELECT * FROM d
+		plan := &PlanNode{NodeType: "CTE Scan", Plans: []PlanNode{
+			{NodeType: "ModifyTable", Operation: "Delete", ParentRelationship: "InitPlan", RelationName: "users"},
+		}}
+
+		err := CheckPlanStatementType(plan, StatementTypeSelect)
+
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "plan contains Delete on users")
+	})
+
+	t.Run("data-modifying CTE with a different operation", func(t *testing.T) {
+		// WITH d AS (DELETE FROM archive RETURNING *) INSERT INTO users SELECT * FROM d
+		plan := &PlanNode{NodeType: "ModifyTable", Operation: "Insert", RelationName: "users", Plans: []PlanNode{
+			{NodeType: "ModifyTable", Operation: "Delete", ParentRelationship: "InitPlan", RelationName: "archive"},
+		}}
+
+		err := CheckPlanStatementType(plan, StatementTypeInsert)
+
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "plan contains Delete on archive")
+	})
+}
+
+func TestCheckPlanLimits(t *testing.T) {
+	_, mock, cleanup := setupMockDB(t)
+	defer cleanup()
+
+	// Save original limits
+	originalLimits := []float64{MaxPlanCost, MaxPlanRows, MaxSeqScanRows, MaxNestedLoopRows}
+	defer func() {
+		MaxPlanCost, MaxPlanRows, MaxSeqScanRows, MaxNestedLoopRows = originalLimits[0], originalLimits[1], originalLimits[2], originalLimits[3]
+	}()
+
+	resetLimits := func() {
+		MaxPlanCost, MaxPlanRows, MaxSeqScanRows, MaxNestedLoopRows = 0, 0, 0, 0
+	}
+
+	// SELECT * FROM events e JOIN users u ON u.id = e.user_id
+	plan := &PlanNode{NodeType: "Nested Loop", TotalCost: 150000, PlanRows: 250000, Plans: []PlanNode{
+		{NodeType: "Seq Scan", ParentRelationship: "Outer", Schema: "public", RelationName: "events", TotalCost: 90000, PlanRows: 250000},
+		{NodeType: "Index Scan", ParentRelationship: "Inner", Schema: "public", RelationName: "users", TotalCost: 0.3, PlanRows: 1},
+	}}
+
+	t.Run("no limits", func(t *testing.T) {
+		resetLimits()
+
+		assert.False(t, PlanLimitsEnabled())
+		assert.NoError(t, CheckPlanLimits(context.Background(), plan))
+	})
+
+	t.Run("total cost", func(t *testing.T) {
+		resetLimits()
+		MaxPlanCost = 1000
+
+		err := CheckPlanLimits(context.Background(), plan)
+
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "Nested Loop has an estimated total cost of 150000.00")
+		assert.Contains(t, err.Error(), "--max-plan-cost")
+	})
+
+	t.Run("estimated rows", func(t *testing.T) {
+		resetLimits()
+		MaxPlanRows = 1000
+
+		err := CheckPlanLimits(context.Background(), plan)
+
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "estimated to return 250000 rows")
+		assert.Contains(t, err.Error(), "--max-plan-rows")
+	})
+
+	t.Run("seq scan on a large table", func(t *testing.T) {
+		resetLimits()
+		MaxSeqScanRows = 1000000
+
+		// Setup mock expectations
+		mock.ExpectQuery("SELECT c.reltuples").
+			WithArgs("public", "events").
+			WillReturnRows(sqlmock.NewRows([]string{"reltuples"}).AddRow(350000000))
+
+		// Call CheckPlanLimits
+		err := CheckPlanLimits(context.Background(), plan)
+
+		// Verify results
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "Seq Scan on public.events")
+		assert.Contains(t, err.Error(), "350000000 rows")
+		assert.Contains(t, err.Error(), "--max-seq-scan-rows")
+	})
+
+	t.Run("seq scan on a small table", func(t *testing.T) {
+		resetLimits()
+		MaxSeqScanRows = 1000000
+
+		// Setup mock expectations
+		mock.ExpectQuery("SELECT c.reltuples").
+			WithArgs("public", "events").
+			WillReturnRows(sqlmock.NewRows([]string{"reltuples"}).AddRow(5000))
+
+		// Call CheckPlanLimits
+		err := CheckPlanLimits(context.Background(), plan)
+
+		// Verify results
+		assert.NoError(t, err)
+	})
+
+	t.Run("seq scan on a never analyzed table", func(t *testing.T) {
+		resetLimits()
+		MaxSeqScanRows = 1000
+
+		// Setup mock expectations
+		mock.ExpectQuery("SELECT c.reltuples").
+			WithArgs("public", "events").
+			WillReturnRows(sqlmock.NewRows([]string{"reltuples"}).AddRow(-1))
+
+		// Call CheckPlanLimits, the plan estimate of 250000 rows is used instead
+		err := CheckPlanLimits(context.Background(), plan)
+
+		// Verify results
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "estimated at 250000 rows")
+	})
+
+	t.Run("nested loop", func(t *testing.T) {
+		resetLimits()
+		MaxNestedLoopRows = 10000
+
+		err := CheckPlanLimits(context.Background(), plan)
+
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "Nested Loop iterates over an estimated 250000 rows from Seq Scan on public.events")
+		assert.Contains(t, err.Error(), "--max-nested-loop-rows")
+	})
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestHandleExplainPlanLimits(t *testing.T) {
+	_, mock, cleanup := setupMockDB(t)
+	defer cleanup()
+
+	// Save original settings
+	originalWithExplainCheck := WithExplainCheck
+	originalMaxPlanCost := MaxPlanCost
+	defer func() {
+		WithExplainCheck = originalWithExplainCheck
+		MaxPlanCost = originalMaxPlanCost
+	}()
+
+	WithExplainCheck = false
+	MaxPlanCost = 100
+
+	t.Run("limits apply to select without explain check", func(t *testing.T) {
+		// Setup mock expectations
+		explainRows := sqlmock.NewRows([]string{"QUERY PLAN"}).
+			AddRow(`[{"Plan": {"Node Type": "Seq Scan", "Schema": "public", "Relation Name": "events", "Total Cost": 4500000.00, "Plan Rows": 100000000}}]`)
+
+		expectTx(mock)
+		mock.ExpectQuery("EXPLAIN").WillReturnRows(explainRows)
+		mock.ExpectRollback()
+
+		// Call HandleExplain
+		err := HandleExplain(context.Background(), "SELECT * FROM events", StatementTypeSelect)
+
+		// Verify results
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "Seq Scan on public.events has an estimated total cost of 4500000.00")
+	})
+
+	t.Run("limits do not apply to writes", func(t *testing.T) {
+		// Call HandleExplain - should return nil without querying
+		err := HandleExplain(context.Background(), "DELETE FROM events", StatementTypeDelete)
+
+		// Verify results
+		assert.NoError(t, err)
+	})
+
+	t.Run("SHOW and EXPLAIN are not explained", func(t *testing.T) {
+		// Call HandleExplain - should return nil without querying
+		for _, query := range []string{"SHOW search_path", "EXPLAIN SELECT * FROM events", "explain (analyze false) SELECT * FROM events"} {
+			assert.NoError(t, HandleExplain(context.Background(), query, StatementTypeSelect), query)
+		}
+	})
+
+	t.Run("EXPLAIN ANALYZE checks the statement it runs", func(t *testing.T) {
+		// Setup mock expectations
+		explainRows := sqlmock.NewRows([]string{"QUERY PLAN"}).
+			AddRow(`[{"Plan": {"Node Type": "Seq Scan", "Schema": "public", "Relation Name": "events", "Total Cost": 4500000.00, "Plan Rows": 100000000}}]`)
+
+		expectTx(mock)
+		mock.ExpectQuery(`^EXPLAIN \(FORMAT JSON, VERBOSE\) SELECT \* FROM events$`).WillReturnRows(explainRows)
+		mock.ExpectRollback()
+
+		// Call HandleExplain
+		err := HandleExplain(context.Background(), "EXPLAIN (ANALYZE, BUFFERS) SELECT * FROM events", StatementTypeSelect)
+
+		// Verify results
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "Seq Scan on public.events has an estimated total cost of 4500000.00")
+	})
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestExplainTarget(t *testing.T) {
+	assert.Equal(t, "SELECT 1", ExplainTarget("SELECT 1"))
+	assert.Equal(t, "", ExplainTarget("SHOW work_mem"))
+	assert.Equal(t, "", ExplainTarget("EXPLAIN VERBOSE SELECT 1"))
+	assert.Equal(t, "DELETE FROM t WHERE id = 1", ExplainTarget("EXPLAIN ANALYZE VERBOSE DELETE FROM t WHERE id = 1"))
+	assert.Equal(t, "SELECT 1", ExplainTarget("explain (analyse on) SELECT 1"))
+	assert.Equal(t, "", ExplainTarget("EXPLAIN ANALYZE"))
+}
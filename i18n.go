@@ -0,0 +1,44 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/nicksnyder/go-i18n/v2/i18n"
+	"github.com/pelletier/go-toml/v2"
+	"golang.org/x/text/language"
+)
+
+// Localizer is replaced in main once the --lang flag is parsed.
+var Localizer = NewLocalizer(language.English.String())
+
+// NewLocalizer loads the embedded message files for lang. English is always
+// loaded as well, so that untranslated messages fall back to it.
+func NewLocalizer(lang string) *i18n.Localizer {
+	bundle := i18n.NewBundle(language.English)
+	bundle.RegisterUnmarshalFunc("toml", toml.Unmarshal)
+
+	langTag, err := language.Parse(lang)
+	if err != nil {
+		langTag = language.English
+	}
+
+	if enData, err := localeFS.ReadFile("locales/en/active.en.toml"); err == nil {
+		bundle.ParseMessageFileBytes(enData, "locales/en/active.en.toml")
+	}
+
+	langFile := fmt.Sprintf("locales/%s/active.%s.toml", langTag.String(), langTag.String())
+	if data, err := localeFS.ReadFile(langFile); err == nil && langTag != language.English {
+		bundle.ParseMessageFileBytes(data, langFile)
+	}
+
+	return i18n.NewLocalizer(bundle, langTag.String())
+}
+
+func T(key string) string {
+	return Localizer.MustLocalize(&i18n.LocalizeConfig{MessageID: key})
+}
+
+// TData localizes a message that has template fields.
+func TData(key string, data map[string]interface{}) string {
+	return Localizer.MustLocalize(&i18n.LocalizeConfig{MessageID: key, TemplateData: data})
+}
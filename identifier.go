@@ -0,0 +1,53 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+// QuoteIdentifier quotes a Postgres identifier the same way quote_ident does
+// for names that need quoting.
+func QuoteIdentifier(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
+
+// QualifiedName returns the quoted `"schema"."table"` form of a relation.
+func QualifiedName(schema, table string) string {
+	return QuoteIdentifier(schema) + "." + QuoteIdentifier(table)
+}
+
+// ResolveRelation looks the relation up in pg_catalog using bind parameters
+// and returns its actual schema and name. When schema is empty the relation
+// must be visible through the current search_path.
+func ResolveRelation(ctx context.Context, schema, table string) (string, string, error) {
+	if table == "" {
+		return "", "", fmt.Errorf("table name is required")
+	}
+
+	db, err := GetDB(ctx)
+	if err != nil {
+		return "", "", err
+	}
+
+	var nspname, relname string
+	err = db.QueryRowxContext(ctx, `SELECT n.nspname, c.relname
+FROM pg_catalog.pg_class c
+JOIN pg_catalog.pg_namespace n ON n.oid = c.relnamespace
+WHERE c.relname = $2
+  AND c.relkind IN ('r', 'p', 'v', 'm', 'f')
+  AND (n.nspname = $1 OR ($1 = '' AND pg_catalog.pg_table_is_visible(c.oid)))
+LIMIT 1`, schema, table).Scan(&nspname, &relname)
+	if err == sql.ErrNoRows {
+		if schema != "" {
+			return "", "", fmt.Errorf("relation %q not found", schema+"."+table)
+		}
+		return "", "", fmt.Errorf("relation %q not found", table)
+	}
+	if err != nil {
+		return "", "", err
+	}
+
+	return nspname, relname, nil
+}
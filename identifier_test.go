@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestQuoteIdentifier(t *testing.T) {
+	assert.Equal(t, `"users"`, QuoteIdentifier("users"))
+	assert.Equal(t, `"Order Items"`, QuoteIdentifier("Order Items"))
+	assert.Equal(t, `"users"";DROP TABLE x;--"`, QuoteIdentifier(`users";DROP TABLE x;--`))
+	assert.Equal(t, `"public"."users"`, QualifiedName("public", "users"))
+}
+
+func TestResolveRelation(t *testing.T) {
+	_, mock, cleanup := setupMockDB(t)
+	defer cleanup()
+
+	t.Run("found through search_path", func(t *testing.T) {
+		// Setup mock expectations
+		rows := sqlmock.NewRows([]string{"nspname", "relname"}).AddRow("public", "users")
+		mock.ExpectQuery("FROM pg_catalog.pg_class").WithArgs("", "users").WillReturnRows(rows)
+
+		// Call ResolveRelation
+		schema, table, err := ResolveRelation(context.Background(), "", "users")
+
+		// Verify results
+		assert.NoError(t, err)
+		assert.Equal(t, "public", schema)
+		assert.Equal(t, "users", table)
+	})
+
+	t.Run("injection attempt is only a bind parameter", func(t *testing.T) {
+		// Setup mock expectations
+		name := "users' OR '1'='1"
+		rows := sqlmock.NewRows([]string{"nspname", "relname"})
+		mock.ExpectQuery("FROM pg_catalog.pg_class").WithArgs("public", name).WillReturnRows(rows)
+
+		// Call ResolveRelation
+		_, _, err := ResolveRelation(context.Background(), "public", name)
+
+		// Verify results
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), `relation "public.users' OR '1'='1" not found`)
+	})
+
+	t.Run("missing table name", func(t *testing.T) {
+		_, _, err := ResolveRelation(context.Background(), "public", "")
+
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "table name is required")
+	})
+
+	t.Run("query error", func(t *testing.T) {
+		// Setup mock expectations
+		mock.ExpectQuery("FROM pg_catalog.pg_class").WillReturnError(fmt.Errorf("query error"))
+
+		// Call ResolveRelation
+		_, _, err := ResolveRelation(context.Background(), "", "users")
+
+		// Verify results
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "query error")
+	})
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
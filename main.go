@@ -1,569 +1,1060 @@
-package main
-
-import (
-	"context"
-	"embed"
-	"encoding/csv"
-	"flag"
-	"fmt"
-	"log"
-	"strings"
-
-	_ "github.com/go-sql-driver/mysql"
-	_ "github.com/jackc/pgx/stdlib"
-	"github.com/jmoiron/sqlx"
-	"github.com/mark3labs/mcp-go/mcp"
-	"github.com/mark3labs/mcp-go/server"
-	"github.com/nicksnyder/go-i18n/v2/i18n"
-	"github.com/pelletier/go-toml/v2"
-	"golang.org/x/text/language"
-)
-
-//go:embed locales/*
-var localeFS embed.FS
-
-const (
-	StatementTypeNoExplainCheck = ""
-	StatementTypeSelect         = "SELECT"
-	StatementTypeInsert         = "INSERT"
-	StatementTypeUpdate         = "UPDATE"
-	StatementTypeDelete         = "DELETE"
-)
-
-var (
-	DSN string
-
-	ReadOnly         bool
-	WithExplainCheck bool
-
-	DB *sqlx.DB
-
-	Transport string
-	IPaddress string
-	Port      int
-
-	Lang string
-)
-
-type ExplainResult struct {
-	Id           *string `db:"id"`
-	SelectType   *string `db:"select_type"`
-	Table        *string `db:"table"`
-	Partitions   *string `db:"partitions"`
-	Type         *string `db:"type"`
-	PossibleKeys *string `db:"possible_keys"`
-	Key          *string `db:"key"`
-	KeyLen       *string `db:"key_len"`
-	Ref          *string `db:"ref"`
-	Rows         *string `db:"rows"`
-	Filtered     *string `db:"filtered"`
-	Extra        *string `db:"Extra"`
-}
-
-type ShowCreateTableResult struct {
-	Table       string `db:"Table"`
-	CreateTable string `db:"Create Table"`
-}
-
-func main() {
-
-	// 初始化i18n
-	bundle := i18n.NewBundle(language.English)
-	bundle.RegisterUnmarshalFunc("toml", toml.Unmarshal)
-
-	flag.StringVar(&DSN, "dsn", "", "POSTGRES DSN")
-	flag.BoolVar(&ReadOnly, "read-only", false, "Enable read-only mode")
-	flag.BoolVar(&WithExplainCheck, "with-explain-check", false, "Check query plan with `EXPLAIN` before executing")
-
-	flag.StringVar(&Transport, "t", "stdio", "Transport type (stdio or sse)")
-	flag.IntVar(&Port, "port", 8080, "sse server port")
-	flag.StringVar(&IPaddress, "ip", "localhost", "server ip address")
-
-	flag.StringVar(&Lang, "lang", language.English.String(), "Language code (en/zh-CN/...)")
-
-	flag.Parse()
-
-	langTag, err := language.Parse(Lang)
-	if err != nil {
-		langTag = language.English
-	}
-
-	langFile := fmt.Sprintf("locales/%s/active.%s.toml", langTag.String(), langTag.String())
-	if data, err := localeFS.ReadFile(langFile); err == nil {
-		bundle.ParseMessageFileBytes(data, langFile)
-	} else {
-		if enData, err := localeFS.ReadFile("locales/en/active.en.toml"); err == nil {
-			bundle.ParseMessageFileBytes(enData, "locales/en/active.en.toml")
-		}
-	}
-
-	localizer := i18n.NewLocalizer(bundle, langTag.String())
-
-	T := func(key string) string {
-		return localizer.MustLocalize(&i18n.LocalizeConfig{MessageID: key})
-	}
-
-	s := server.NewMCPServer(
-		"go-mcp-postgres",
-		"0.2.1",
-		server.WithResourceCapabilities(true, true),
-		server.WithPromptCapabilities(true),
-		server.WithLogging(),
-	)
-
-	// Schema Tools
-	listDatabaseTool := mcp.NewTool(
-		"list_database",
-		mcp.WithDescription(T("gomcp.list_database")),
-	)
-
-	listTableTool := mcp.NewTool(
-		"list_table",
-		mcp.WithDescription(T("gomcp.list_table")),
-	)
-
-	createTableTool := mcp.NewTool(
-		"create_table",
-		mcp.WithDescription(T("gomcp.create_table")),
-		mcp.WithString("query",
-			mcp.Required(),
-			mcp.Description(T("gomcp.create_table_query_description")),
-		),
-	)
-
-	alterTableTool := mcp.NewTool(
-		"alter_table",
-		mcp.WithDescription(T("gomcp.alter_table")),
-		mcp.WithString("query",
-			mcp.Required(),
-			mcp.Description(T("gomcp.alter_table_query")),
-		),
-	)
-
-	descTableTool := mcp.NewTool(
-		"desc_table",
-		mcp.WithDescription(T("gomcp.desc_table")),
-		mcp.WithString("name",
-			mcp.Required(),
-			mcp.Description(T("gomcp.desc_table_name")),
-		),
-	)
-
-	// Data Tools
-	readQueryTool := mcp.NewTool(
-		"read_query",
-		mcp.WithDescription(T("gomcp.read_query")),
-		mcp.WithString("query",
-			mcp.Required(),
-			mcp.Description(T("gomcp.query_execute_description")),
-		),
-	)
-
-	countQueryTool := mcp.NewTool(
-		"count_query",
-		mcp.WithDescription(T("gomcp.count_query")),
-		mcp.WithString("name",
-			mcp.Required(),
-			mcp.Description(T("gomcp.count_query_name")),
-		),
-	)
-
-	writeQueryTool := mcp.NewTool(
-		"write_query",
-		mcp.WithDescription(T("gomcp.write_query")),
-		mcp.WithString("query",
-			mcp.Required(),
-			mcp.Description(T("gomcp.query_execute_description")),
-		),
-	)
-
-	updateQueryTool := mcp.NewTool(
-		"update_query",
-		mcp.WithDescription(T("gomcp.update_query")),
-		mcp.WithString("query",
-			mcp.Required(),
-			mcp.Description(T("gomcp.query_execute_description")),
-		),
-	)
-
-	deleteQueryTool := mcp.NewTool(
-		"delete_query",
-		mcp.WithDescription(T("gomcp.delete_query")),
-		mcp.WithString("query",
-			mcp.Required(),
-			mcp.Description(T("gomcp.query_execute_description")),
-		),
-	)
-
-	s.AddTool(listDatabaseTool, func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
-		result, err := HandleQuery("SELECT datname FROM pg_database WHERE datistemplate = false;", StatementTypeNoExplainCheck)
-		if err != nil {
-			return nil, nil
-		}
-
-		return mcp.NewToolResultText(result), nil
-	})
-
-	s.AddTool(listTableTool, func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
-		result, err := HandleQuery("SELECT table_schema,table_name FROM information_schema.tables ORDER BY table_schema,table_name;", StatementTypeNoExplainCheck)
-		if err != nil {
-			return nil, nil
-		}
-
-		return mcp.NewToolResultText(result), nil
-	})
-
-	if !ReadOnly {
-		s.AddTool(createTableTool, func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
-			result, err := HandleExec(request.Params.Arguments["query"].(string), StatementTypeNoExplainCheck)
-			if err != nil {
-				return nil, nil
-			}
-
-			return mcp.NewToolResultText(result), nil
-		})
-	}
-
-	if !ReadOnly {
-		s.AddTool(alterTableTool, func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
-			result, err := HandleExec(request.Params.Arguments["query"].(string), StatementTypeNoExplainCheck)
-			if err != nil {
-				return nil, nil
-			}
-
-			return mcp.NewToolResultText(result), nil
-		})
-	}
-	s.AddTool(listTableTool, func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
-		result, err := HandleQuery("SELECT table_schema,table_name FROM information_schema.tables ORDER BY table_schema,table_name;", StatementTypeNoExplainCheck)
-		if err != nil {
-			return nil, nil
-		}
-
-		return mcp.NewToolResultText(result), nil
-	})
-
-	s.AddTool(descTableTool, func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
-		descsql :=
-			`SELECT
-    'CREATE TABLE ' || t.table_name || ' (' ||
-    string_agg(
-        c.column_name || ' ' || c.data_type ||
-        CASE 
-            WHEN c.character_maximum_length IS NOT NULL THEN '(' || c.character_maximum_length || ')'
-            ELSE ''
-        END ||
-        CASE 
-            WHEN c.is_nullable = 'NO' THEN ' NOT NULL'
-            ELSE ''
-        END, ', '
-    ) ||
-    ', PRIMARY KEY (' || (
-        SELECT string_agg(kcu.column_name, ', ')
-        FROM information_schema.key_column_usage kcu
-        WHERE kcu.table_name = t.table_name AND kcu.constraint_name LIKE '%_pkey'
-    ) || ')' ||
-    ');' AS create_table_sql
-FROM
-    information_schema.tables t
-JOIN
-    information_schema.columns c ON t.table_name = c.table_name
-WHERE
-    t.table_name = '` + request.Params.Arguments["name"].(string) + `'
-GROUP BY
-    t.table_name;`
-		result, err := HandleQuery(descsql, StatementTypeNoExplainCheck)
-		if err != nil {
-			return nil, nil
-		}
-
-		return mcp.NewToolResultText(result), nil
-	})
-
-	s.AddTool(readQueryTool, func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
-		result, err := HandleQuery(request.Params.Arguments["query"].(string), StatementTypeSelect)
-		if err != nil {
-			return nil, nil
-		}
-
-		return mcp.NewToolResultText(result), nil
-	})
-	s.AddTool(countQueryTool, func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
-		result, err := HandleQuery("SELECT count(1) from "+request.Params.Arguments["name"].(string)+";", StatementTypeNoExplainCheck)
-		if err != nil {
-			return nil, nil
-		}
-
-		return mcp.NewToolResultText(result), nil
-	})
-
-	if !ReadOnly {
-		s.AddTool(writeQueryTool, func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
-			result, err := HandleExec(request.Params.Arguments["query"].(string), StatementTypeInsert)
-			if err != nil {
-				return nil, nil
-			}
-
-			return mcp.NewToolResultText(result), nil
-		})
-	}
-
-	if !ReadOnly {
-		s.AddTool(updateQueryTool, func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
-			result, err := HandleExec(request.Params.Arguments["query"].(string), StatementTypeUpdate)
-			if err != nil {
-				return nil, nil
-			}
-
-			return mcp.NewToolResultText(result), nil
-		})
-	}
-
-	if !ReadOnly {
-		s.AddTool(deleteQueryTool, func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
-			result, err := HandleExec(request.Params.Arguments["query"].(string), StatementTypeDelete)
-			if err != nil {
-				return nil, nil
-			}
-
-			return mcp.NewToolResultText(result), nil
-		})
-	}
-
-	// Only check for "sse" since stdio is the default
-	if Transport == "sse" {
-		sseServer := server.NewSSEServer(s, server.WithBaseURL(fmt.Sprintf("http://%s:%d", IPaddress, Port)))
-		//log.Printf("SSE server listening on : %d", Port)
-		if err := sseServer.Start(fmt.Sprintf("%s:%d", IPaddress, Port)); err != nil {
-			log.Fatalf("Server error: %v", err)
-		}
-	} else {
-		if err := server.ServeStdio(s); err != nil {
-			log.Fatalf("Server error: %v", err)
-		}
-	}
-
-}
-
-func GetDB() (*sqlx.DB, error) {
-	if DB != nil {
-		return DB, nil
-	}
-
-	db, err := sqlx.Connect("pgx", DSN)
-	if err != nil {
-		return nil, fmt.Errorf("failed to establish database connection: %v", err)
-	}
-
-	DB = db
-
-	return DB, nil
-}
-
-func HandleQuery(query, expect string) (string, error) {
-	result, headers, err := DoQuery(query, expect)
-	if err != nil {
-		return "", err
-	}
-
-	s, err := MapToCSV(result, headers)
-	if err != nil {
-		return "", err
-	}
-
-	return s, nil
-}
-
-func DoQuery(query, expect string) ([]map[string]interface{}, []string, error) {
-	db, err := GetDB()
-	if err != nil {
-		return nil, nil, err
-	}
-
-	if len(expect) > 0 {
-		if err := HandleExplain(query, expect); err != nil {
-			return nil, nil, err
-		}
-	}
-
-	rows, err := db.Queryx(query)
-	if err != nil {
-		return nil, nil, err
-	}
-
-	cols, err := rows.Columns()
-	if err != nil {
-		return nil, nil, err
-	}
-
-	result := []map[string]interface{}{}
-	for rows.Next() {
-		row, err := rows.SliceScan()
-		if err != nil {
-			return nil, nil, err
-		}
-
-		resultRow := map[string]interface{}{}
-		for i, col := range cols {
-			switch v := row[i].(type) {
-			case []byte:
-				resultRow[col] = string(v)
-			default:
-				resultRow[col] = v
-			}
-		}
-		result = append(result, resultRow)
-	}
-
-	return result, cols, nil
-}
-
-func HandleExec(query, expect string) (string, error) {
-	db, err := GetDB()
-	if err != nil {
-		return "", err
-	}
-
-	if len(expect) > 0 {
-		if err := HandleExplain(query, expect); err != nil {
-			return "", err
-		}
-	}
-
-	result, err := db.Exec(query)
-	if err != nil {
-		return "", err
-	}
-
-	ra, err := result.RowsAffected()
-	if err != nil {
-		return "", err
-	}
-
-	switch expect {
-	case StatementTypeInsert:
-		li, err := result.LastInsertId()
-		if err != nil {
-			return "", err
-		}
-
-		return fmt.Sprintf("%d rows affected, last insert id: %d", ra, li), nil
-	default:
-		return fmt.Sprintf("%d rows affected", ra), nil
-	}
-}
-
-func HandleExplain(query, expect string) error {
-	if !WithExplainCheck {
-		return nil
-	}
-
-	db, err := GetDB()
-	if err != nil {
-		return err
-	}
-
-	rows, err := db.Queryx(fmt.Sprintf("EXPLAIN %s", query))
-	if err != nil {
-		return err
-	}
-
-	result := []ExplainResult{}
-	for rows.Next() {
-		var row ExplainResult
-		if err := rows.StructScan(&row); err != nil {
-			return err
-		}
-		result = append(result, row)
-	}
-
-	if len(result) != 1 {
-		return fmt.Errorf("unable to check query plan, denied")
-	}
-
-	match := false
-	switch expect {
-	case StatementTypeInsert:
-		fallthrough
-	case StatementTypeUpdate:
-		fallthrough
-	case StatementTypeDelete:
-		if *result[0].SelectType == expect {
-			match = true
-		}
-	default:
-		// for SELECT type query, the select_type will be multiple values
-		// here we check if it's not INSERT, UPDATE or DELETE
-		match = true
-		for _, typ := range []string{StatementTypeInsert, StatementTypeUpdate, StatementTypeDelete} {
-			if *result[0].SelectType == typ {
-				match = false
-				break
-			}
-		}
-	}
-
-	if !match {
-		return fmt.Errorf("query plan does not match expected pattern, denied")
-	}
-
-	return nil
-}
-
-/*
-func HandleDescTable(name string) (string, error) {
-	db, err := GetDB()
-	if err != nil {
-		return "", err
-	}
-
-	rows, err := db.Queryx(descsql)
-	if err != nil {
-		return "", err
-	}
-
-	result := []ShowCreateTableResult{}
-	for rows.Next() {
-		var row ShowCreateTableResult
-		if err := rows.StructScan(&row); err != nil {
-			return "", err
-		}
-		result = append(result, row)
-	}
-
-	if len(result) == 0 {
-		return "", fmt.Errorf("table %s does not exist", name)
-	}
-
-	return result[0].CreateTable, nil
-}*/
-
-func MapToCSV(m []map[string]interface{}, headers []string) (string, error) {
-	var csvBuf strings.Builder
-	writer := csv.NewWriter(&csvBuf)
-
-	if err := writer.Write(headers); err != nil {
-		return "", fmt.Errorf("failed to write headers: %v", err)
-	}
-
-	for _, item := range m {
-		row := make([]string, len(headers))
-		for i, header := range headers {
-			value, exists := item[header]
-			if !exists {
-				return "", fmt.Errorf("key '%s' not found in map", header)
-			}
-			row[i] = fmt.Sprintf("%v", value)
-		}
-		if err := writer.Write(row); err != nil {
-			return "", fmt.Errorf("failed to write row: %v", err)
-		}
-	}
-
-	writer.Flush()
-	if err := writer.Error(); err != nil {
-		return "", fmt.Errorf("error flushing CSV writer: %v", err)
-	}
-
-	return csvBuf.String(), nil
-}
+package main
+
+import (
+	"context"
+	"embed"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	_ "github.com/go-sql-driver/mysql"
+	"github.com/jmoiron/sqlx"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+	"golang.org/x/text/language"
+)
+
+//go:embed locales/*
+var localeFS embed.FS
+
+const (
+	StatementTypeNoExplainCheck = ""
+	StatementTypeSelect         = "SELECT"
+	StatementTypeInsert         = "INSERT"
+	StatementTypeUpdate         = "UPDATE"
+	StatementTypeDelete         = "DELETE"
+	StatementTypeCreate         = "CREATE"
+	StatementTypeAlter          = "ALTER"
+)
+
+var (
+	DSN string
+
+	ReadOnly         bool
+	WithExplainCheck bool
+
+	MaxPlanCost       float64
+	MaxPlanRows       float64
+	MaxSeqScanRows    float64
+	MaxNestedLoopRows float64
+
+	StatementTimeout         time.Duration
+	LockTimeout              time.Duration
+	IdleInTransactionTimeout time.Duration
+
+	DB *sqlx.DB
+
+	Transport string
+	IPaddress string
+	Port      int
+
+	Lang string
+)
+
+func main() {
+
+	flag.StringVar(&DSN, "dsn", "", "POSTGRES DSN")
+	flag.BoolVar(&ReadOnly, "read-only", false, "Enable read-only mode")
+	flag.BoolVar(&WithExplainCheck, "with-explain-check", false, "Check query plan with `EXPLAIN` before executing")
+	flag.Float64Var(&MaxPlanCost, "max-plan-cost", 0, "Reject read queries whose estimated plan cost exceeds this value (0 disables)")
+	flag.Float64Var(&MaxPlanRows, "max-plan-rows", 0, "Reject read queries estimated to return more rows than this (0 disables)")
+	flag.Float64Var(&MaxSeqScanRows, "max-seq-scan-rows", 0, "Reject read queries that sequentially scan a table with more rows than this (0 disables)")
+	flag.Float64Var(&MaxNestedLoopRows, "max-nested-loop-rows", 0, "Reject read queries with a nested loop over more outer rows than this (0 disables)")
+
+	flag.DurationVar(&StatementTimeout, "statement-timeout", 30*time.Second, "statement_timeout for every statement (0 disables)")
+	flag.DurationVar(&LockTimeout, "lock-timeout", 5*time.Second, "lock_timeout for every statement (0 disables)")
+	flag.DurationVar(&IdleInTransactionTimeout, "idle-in-transaction-timeout", time.Minute, "idle_in_transaction_session_timeout for every statement (0 disables)")
+
+	flag.IntVar(&DefaultRowLimit, "default-row-limit", 1000, "Rows returned by read_query when no limit is given")
+	flag.IntVar(&MaxRowLimit, "max-row-limit", 10000, "Maximum rows returned by a single read_query call")
+	flag.IntVar(&MaxCursors, "max-cursors", 5, "Maximum read_query cursors kept open, the oldest is closed beyond it (0 disables)")
+	flag.IntVar(&MaxSessionCursors, "max-session-cursors", 2, "Maximum read_query cursors kept open per session, the oldest is closed beyond it (0 disables)")
+	flag.IntVar(&MaxOutputBytes, "max-output-bytes", 1<<20, "Maximum size of a single query result in bytes (0 disables)")
+
+	flag.IntVar(&MaxOpenConns, "max-open-conns", 10, "Maximum number of open database connections (0 uses the pgx default)")
+	flag.IntVar(&MinIdleConns, "min-idle-conns", 0, "Number of idle database connections kept open")
+	flag.DurationVar(&ConnMaxLifetime, "conn-max-lifetime", 30*time.Minute, "Close database connections after this long (0 keeps them forever)")
+	flag.DurationVar(&ConnMaxIdleTime, "conn-max-idle-time", 5*time.Minute, "Close database connections idle for this long (0 keeps them forever)")
+	flag.DurationVar(&ConnectTimeout, "connect-timeout", 30*time.Second, "Keep retrying the initial database connection for this long (0 tries once)")
+	flag.DurationVar(&HealthCheckInterval, "health-check-interval", 30*time.Second, "Ping the database this often and reconnect after repeated failures (0 disables)")
+
+	flag.StringVar(&SchemaNotifyChannel, "schema-notify-channel", "", "LISTEN on this channel for schema changes sent by the DDL event trigger")
+
+	flag.BoolVar(&AllowUnfilteredWrites, "allow-unfiltered-writes", false, "Allow UPDATE and DELETE without a WHERE clause")
+	flag.Int64Var(&MaxAffectedRows, "max-affected-rows", 0, "Roll back UPDATE and DELETE statements that change more rows than this (0 disables)")
+
+	flag.StringVar(&ApprovalMode, "approval", "", "Require an approver to confirm write and DDL statements: tool (approve_statement tool) or http (/approvals endpoints of the sse server)")
+	flag.StringVar(&ApprovalSecret, "approval-secret", "", "Secret required by the /approvals endpoints and the approve_statement and reject_statement tools")
+	flag.DurationVar(&ApprovalTimeout, "approval-timeout", time.Hour, "Discard statements that were not approved within this long")
+
+	var toolTimeouts string
+	flag.DurationVar(&SessionTxTimeout, "session-tx-timeout", 5*time.Minute, "Roll back transactions opened by begin_transaction after being idle for this long (0 disables)")
+	flag.IntVar(&MaxSessionTxs, "max-session-txs", 3, "Maximum transactions opened by begin_transaction kept open across all sessions (0 disables)")
+	flag.DurationVar(&ToolTimeout, "tool-timeout", 5*time.Minute, "Cancel tool calls that run longer than this (0 disables)")
+	flag.StringVar(&toolTimeouts, "tool-timeouts", "", "Per tool timeouts overriding --tool-timeout, e.g. read_query=2m,write_query=30s")
+
+	flag.StringVar(&Transport, "t", "stdio", "Transport type (stdio or sse)")
+	flag.IntVar(&Port, "port", 8080, "sse server port")
+	flag.StringVar(&IPaddress, "ip", "localhost", "server ip address")
+
+	flag.StringVar(&Lang, "lang", language.English.String(), "Language code (en/zh-CN/...)")
+
+	flag.Parse()
+
+	var err error
+	if ToolTimeouts, err = ParseToolTimeouts(toolTimeouts); err != nil {
+		log.Fatalf("Invalid --tool-timeouts: %v", err)
+	}
+	if err := CheckApprovalConfig(); err != nil {
+		log.Fatalf("Invalid approval flags: %v", err)
+	}
+
+	// 初始化i18n
+	Localizer = NewLocalizer(Lang)
+
+	hooks := &server.Hooks{}
+	AddCancelHooks(hooks)
+
+	s := server.NewMCPServer(
+		"go-mcp-postgres",
+		"0.2.1",
+		server.WithResourceCapabilities(true, true),
+		server.WithPromptCapabilities(true),
+		server.WithLogging(),
+		server.WithHooks(hooks),
+	)
+	s.AddNotificationHandler(MethodCancelled, HandleCancelled)
+
+	// Schema Tools
+	listDatabaseTool := mcp.NewTool(
+		"list_database",
+		mcp.WithDescription(T("gomcp.list_database")),
+		mcp.WithString("format",
+			mcp.Enum(FormatCSV, FormatJSON, FormatNDJSON, FormatMarkdown),
+			mcp.Description(T("gomcp.format_description")),
+		),
+	)
+
+	listTableTool := mcp.NewTool(
+		"list_table",
+		mcp.WithDescription(T("gomcp.list_table")),
+		mcp.WithString("schema",
+			mcp.Description(T("gomcp.list_table_schema_description")),
+		),
+		mcp.WithString("name",
+			mcp.Description(T("gomcp.list_table_name_description")),
+		),
+		mcp.WithBoolean("include_system",
+			mcp.Description(T("gomcp.list_table_include_system_description")),
+		),
+		mcp.WithArray("kinds",
+			mcp.Description(T("gomcp.list_table_kinds_description")),
+		),
+		mcp.WithString("format",
+			mcp.Enum(FormatCSV, FormatJSON, FormatNDJSON, FormatMarkdown),
+			mcp.Description(T("gomcp.format_description")),
+		),
+	)
+
+	createTableTool := mcp.NewTool(
+		"create_table",
+		mcp.WithDescription(T("gomcp.create_table")),
+		mcp.WithString("query",
+			mcp.Required(),
+			mcp.Description(T("gomcp.create_table_query_description")),
+		),
+	)
+
+	alterTableTool := mcp.NewTool(
+		"alter_table",
+		mcp.WithDescription(T("gomcp.alter_table")),
+		mcp.WithString("query",
+			mcp.Required(),
+			mcp.Description(T("gomcp.alter_table_query")),
+		),
+	)
+
+	descTableTool := mcp.NewTool(
+		"desc_table",
+		mcp.WithDescription(T("gomcp.desc_table")),
+		mcp.WithString("schema",
+			mcp.Description(T("gomcp.table_schema_description")),
+		),
+		mcp.WithString("table",
+			mcp.Required(),
+			mcp.Description(T("gomcp.desc_table_name")),
+		),
+	)
+
+	// Data Tools
+	readQueryTool := mcp.NewTool(
+		"read_query",
+		mcp.WithDescription(T("gomcp.read_query")),
+		mcp.WithString("query",
+			mcp.Description(T("gomcp.read_query_query_description")),
+		),
+		mcp.WithArray("params",
+			mcp.Description(T("gomcp.query_params_description")),
+		),
+		mcp.WithNumber("limit",
+			mcp.Description(T("gomcp.read_query_limit_description")),
+		),
+		mcp.WithString("cursor",
+			mcp.Description(T("gomcp.read_query_cursor_description")),
+		),
+		mcp.WithString("format",
+			mcp.Enum(FormatCSV, FormatJSON, FormatNDJSON, FormatMarkdown),
+			mcp.Description(T("gomcp.format_description")),
+		),
+	)
+
+	countQueryTool := mcp.NewTool(
+		"count_query",
+		mcp.WithDescription(T("gomcp.count_query")),
+		mcp.WithString("schema",
+			mcp.Description(T("gomcp.table_schema_description")),
+		),
+		mcp.WithString("table",
+			mcp.Required(),
+			mcp.Description(T("gomcp.count_query_name")),
+		),
+		mcp.WithString("format",
+			mcp.Enum(FormatCSV, FormatJSON, FormatNDJSON, FormatMarkdown),
+			mcp.Description(T("gomcp.format_description")),
+		),
+	)
+
+	writeQueryTool := mcp.NewTool(
+		"write_query",
+		mcp.WithDescription(T("gomcp.write_query")),
+		mcp.WithString("query",
+			mcp.Required(),
+			mcp.Description(T("gomcp.query_execute_description")),
+		),
+		mcp.WithArray("params",
+			mcp.Description(T("gomcp.query_params_description")),
+		),
+		mcp.WithNumber("limit",
+			mcp.Description(T("gomcp.returning_limit_description")),
+		),
+		mcp.WithString("format",
+			mcp.Enum(FormatCSV, FormatJSON, FormatNDJSON, FormatMarkdown),
+			mcp.Description(T("gomcp.format_description")),
+		),
+	)
+
+	updateQueryTool := mcp.NewTool(
+		"update_query",
+		mcp.WithDescription(T("gomcp.update_query")),
+		mcp.WithString("query",
+			mcp.Required(),
+			mcp.Description(T("gomcp.query_execute_description")),
+		),
+		mcp.WithArray("params",
+			mcp.Description(T("gomcp.query_params_description")),
+		),
+		mcp.WithBoolean("dry_run",
+			mcp.Description(T("gomcp.dry_run_description")),
+		),
+		mcp.WithNumber("limit",
+			mcp.Description(T("gomcp.returning_limit_description")),
+		),
+		mcp.WithString("format",
+			mcp.Enum(FormatCSV, FormatJSON, FormatNDJSON, FormatMarkdown),
+			mcp.Description(T("gomcp.format_description")),
+		),
+	)
+
+	deleteQueryTool := mcp.NewTool(
+		"delete_query",
+		mcp.WithDescription(T("gomcp.delete_query")),
+		mcp.WithString("query",
+			mcp.Required(),
+			mcp.Description(T("gomcp.query_execute_description")),
+		),
+		mcp.WithArray("params",
+			mcp.Description(T("gomcp.query_params_description")),
+		),
+		mcp.WithBoolean("dry_run",
+			mcp.Description(T("gomcp.dry_run_description")),
+		),
+		mcp.WithNumber("limit",
+			mcp.Description(T("gomcp.returning_limit_description")),
+		),
+		mcp.WithString("format",
+			mcp.Enum(FormatCSV, FormatJSON, FormatNDJSON, FormatMarkdown),
+			mcp.Description(T("gomcp.format_description")),
+		),
+	)
+
+	transactionTool := mcp.NewTool(
+		"transaction",
+		mcp.WithDescription(T("gomcp.transaction")),
+		mcp.WithArray("statements",
+			mcp.Required(),
+			mcp.Description(T("gomcp.transaction_statements_description")),
+			mcp.Items(map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"query":  map[string]interface{}{"type": "string"},
+					"params": map[string]interface{}{"type": "array"},
+					"type": map[string]interface{}{
+						"type": "string",
+						"enum": []string{"select", "insert", "update", "delete"},
+					},
+				},
+				"required": []string{"query"},
+			}),
+		),
+		mcp.WithString("isolation_level",
+			mcp.Enum("read_committed", "repeatable_read", "serializable"),
+			mcp.Description(T("gomcp.transaction_isolation_level_description")),
+		),
+		mcp.WithNumber("limit",
+			mcp.Description(T("gomcp.transaction_limit_description")),
+		),
+		mcp.WithString("format",
+			mcp.Enum(FormatCSV, FormatJSON, FormatNDJSON, FormatMarkdown),
+			mcp.Description(T("gomcp.format_description")),
+		),
+	)
+
+	beginTransactionTool := mcp.NewTool(
+		"begin_transaction",
+		mcp.WithDescription(T("gomcp.begin_transaction")),
+		mcp.WithString("isolation_level",
+			mcp.Enum("read_committed", "repeatable_read", "serializable"),
+			mcp.Description(T("gomcp.transaction_isolation_level_description")),
+		),
+	)
+
+	commitTool := mcp.NewTool(
+		"commit",
+		mcp.WithDescription(T("gomcp.commit")),
+	)
+
+	rollbackTool := mcp.NewTool(
+		"rollback",
+		mcp.WithDescription(T("gomcp.rollback")),
+	)
+
+	approveStatementTool := mcp.NewTool(
+		"approve_statement",
+		mcp.WithDescription(T("gomcp.approve_statement")),
+		mcp.WithString("token",
+			mcp.Required(),
+			mcp.Description(T("gomcp.approval_token_description")),
+		),
+		mcp.WithString("secret",
+			mcp.Required(),
+			mcp.Description(T("gomcp.approval_secret_description")),
+		),
+	)
+
+	rejectStatementTool := mcp.NewTool(
+		"reject_statement",
+		mcp.WithDescription(T("gomcp.reject_statement")),
+		mcp.WithString("token",
+			mcp.Required(),
+			mcp.Description(T("gomcp.approval_token_description")),
+		),
+		mcp.WithString("secret",
+			mcp.Required(),
+			mcp.Description(T("gomcp.approval_secret_description")),
+		),
+		mcp.WithString("reason",
+			mcp.Description(T("gomcp.approval_reason_description")),
+		),
+	)
+
+	approvalStatusTool := mcp.NewTool(
+		"approval_status",
+		mcp.WithDescription(T("gomcp.approval_status")),
+		mcp.WithString("token",
+			mcp.Required(),
+			mcp.Description(T("gomcp.approval_token_description")),
+		),
+	)
+
+	s.AddTool(listDatabaseTool, WithToolTimeout(listDatabaseTool.Name, func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		format, err := ParseFormat(request.GetArguments()["format"])
+		if err != nil {
+			return ErrorResult(err), nil
+		}
+
+		page, err := StreamQuery(ctx, "SELECT datname FROM pg_database WHERE datistemplate = false;", StatementTypeNoExplainCheck, format, 0)
+		if err != nil {
+			return ErrorResult(err), nil
+		}
+
+		return PageResult(page)
+	}))
+
+	s.AddTool(listTableTool, WithToolTimeout(listTableTool.Name, func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		format, err := ParseFormat(request.GetArguments()["format"])
+		if err != nil {
+			return ErrorResult(err), nil
+		}
+
+		kinds, err := ParseRelationKinds(request.GetArguments()["kinds"])
+		if err != nil {
+			return ErrorResult(err), nil
+		}
+
+		schema, _ := request.GetArguments()["schema"].(string)
+		name, _ := request.GetArguments()["name"].(string)
+		includeSystem, _ := request.GetArguments()["include_system"].(bool)
+		page, err := ListTables(ctx, schema, name, includeSystem, kinds, format)
+		if err != nil {
+			return ErrorResult(err), nil
+		}
+
+		return PageResult(page)
+	}))
+
+	if !ReadOnly {
+		s.AddTool(createTableTool, WithToolTimeout(createTableTool.Name, WithApproval(createTableTool.Name, StatementTypeCreate, false, func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			query := request.GetArguments()["query"].(string)
+			result, err := HandleExec(ctx, query, StatementTypeCreate)
+			if err != nil {
+				return ErrorResult(err), nil
+			}
+			NotifyDDL(ctx, s, query)
+
+			return mcp.NewToolResultText(result), nil
+		})))
+	}
+
+	if !ReadOnly {
+		s.AddTool(alterTableTool, WithToolTimeout(alterTableTool.Name, WithApproval(alterTableTool.Name, StatementTypeAlter, false, func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			query := request.GetArguments()["query"].(string)
+			result, err := HandleExec(ctx, query, StatementTypeAlter)
+			if err != nil {
+				return ErrorResult(err), nil
+			}
+			NotifyDDL(ctx, s, query)
+
+			return mcp.NewToolResultText(result), nil
+		})))
+	}
+
+	s.AddTool(descTableTool, WithToolTimeout(descTableTool.Name, func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		schema, _ := request.GetArguments()["schema"].(string)
+		table, _ := request.GetArguments()["table"].(string)
+		schema, table, err := ResolveRelation(ctx, schema, table)
+		if err != nil {
+			return ErrorResult(err), nil
+		}
+
+		result, err := HandleDescTable(ctx, schema, table)
+		if err != nil {
+			return ErrorResult(err), nil
+		}
+
+		return mcp.NewToolResultText(result), nil
+	}))
+
+	s.AddTool(readQueryTool, WithToolTimeout(readQueryTool.Name, func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		format, err := ParseFormat(request.GetArguments()["format"])
+		if err != nil {
+			return ErrorResult(err), nil
+		}
+
+		limit := RowLimit(request.GetArguments()["limit"])
+		if cursor, _ := request.GetArguments()["cursor"].(string); cursor != "" {
+			page, err := ReadCursor(ctx, cursor, format, limit)
+			if err != nil {
+				return ErrorResult(err), nil
+			}
+
+			return PageResult(page)
+		}
+
+		args, err := ParseParams(request.GetArguments()["params"])
+		if err != nil {
+			return ErrorResult(err), nil
+		}
+
+		query, _ := request.GetArguments()["query"].(string)
+		page, err := ReadQuery(ctx, query, format, limit, args...)
+		if err != nil {
+			return ErrorResult(err), nil
+		}
+
+		return PageResult(page)
+	}))
+	s.AddTool(countQueryTool, WithToolTimeout(countQueryTool.Name, func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		format, err := ParseFormat(request.GetArguments()["format"])
+		if err != nil {
+			return ErrorResult(err), nil
+		}
+
+		schema, _ := request.GetArguments()["schema"].(string)
+		table, _ := request.GetArguments()["table"].(string)
+		schema, table, err = ResolveRelation(ctx, schema, table)
+		if err != nil {
+			return ErrorResult(err), nil
+		}
+
+		page, err := StreamQuery(ctx, "SELECT count(1) FROM "+QualifiedName(schema, table)+";", StatementTypeNoExplainCheck, format, 0)
+		if err != nil {
+			return ErrorResult(err), nil
+		}
+
+		return PageResult(page)
+	}))
+
+	if !ReadOnly {
+		s.AddTool(writeQueryTool, WithToolTimeout(writeQueryTool.Name, WithApproval(writeQueryTool.Name, StatementTypeInsert, false, func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			format, err := ParseFormat(request.GetArguments()["format"])
+			if err != nil {
+				return ErrorResult(err), nil
+			}
+
+			args, err := ParseParams(request.GetArguments()["params"])
+			if err != nil {
+				return ErrorResult(err), nil
+			}
+
+			limit := RowLimit(request.GetArguments()["limit"])
+			result, err := HandleWrite(ctx, request.GetArguments()["query"].(string), StatementTypeInsert, format, limit, args...)
+			if err != nil {
+				return ErrorResult(err), nil
+			}
+
+			return result.ToolResult()
+		})))
+	}
+
+	if !ReadOnly {
+		s.AddTool(updateQueryTool, WithToolTimeout(updateQueryTool.Name, WithApproval(updateQueryTool.Name, StatementTypeUpdate, true, func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			format, err := ParseFormat(request.GetArguments()["format"])
+			if err != nil {
+				return ErrorResult(err), nil
+			}
+
+			args, err := ParseParams(request.GetArguments()["params"])
+			if err != nil {
+				return ErrorResult(err), nil
+			}
+
+			limit := RowLimit(request.GetArguments()["limit"])
+			if dryRun, _ := request.GetArguments()["dry_run"].(bool); dryRun {
+				result, err := HandleDryRun(ctx, request.GetArguments()["query"].(string), StatementTypeUpdate, format, limit, args...)
+				if err != nil {
+					return ErrorResult(err), nil
+				}
+
+				return result.ToolResult()
+			}
+
+			result, err := HandleWrite(ctx, request.GetArguments()["query"].(string), StatementTypeUpdate, format, limit, args...)
+			if err != nil {
+				return ErrorResult(err), nil
+			}
+
+			return result.ToolResult()
+		})))
+	}
+
+	if !ReadOnly {
+		s.AddTool(deleteQueryTool, WithToolTimeout(deleteQueryTool.Name, WithApproval(deleteQueryTool.Name, StatementTypeDelete, true, func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			format, err := ParseFormat(request.GetArguments()["format"])
+			if err != nil {
+				return ErrorResult(err), nil
+			}
+
+			args, err := ParseParams(request.GetArguments()["params"])
+			if err != nil {
+				return ErrorResult(err), nil
+			}
+
+			limit := RowLimit(request.GetArguments()["limit"])
+			if dryRun, _ := request.GetArguments()["dry_run"].(bool); dryRun {
+				result, err := HandleDryRun(ctx, request.GetArguments()["query"].(string), StatementTypeDelete, format, limit, args...)
+				if err != nil {
+					return ErrorResult(err), nil
+				}
+
+				return result.ToolResult()
+			}
+
+			result, err := HandleWrite(ctx, request.GetArguments()["query"].(string), StatementTypeDelete, format, limit, args...)
+			if err != nil {
+				return ErrorResult(err), nil
+			}
+
+			return result.ToolResult()
+		})))
+	}
+
+	if !ReadOnly && ApprovalMode == "" {
+		s.AddTool(transactionTool, WithToolTimeout(transactionTool.Name, func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			format, err := ParseFormat(request.GetArguments()["format"])
+			if err != nil {
+				return ErrorResult(err), nil
+			}
+
+			stmts, err := ParseTxStatements(request.GetArguments()["statements"])
+			if err != nil {
+				return ErrorResult(err), nil
+			}
+
+			isolation, _ := request.GetArguments()["isolation_level"].(string)
+			limit := RowLimit(request.GetArguments()["limit"])
+			result, err := RunTransaction(ctx, stmts, isolation, format, limit)
+			if result == nil {
+				return ErrorResult(err), nil
+			}
+
+			return result.ToolResult(err)
+		}))
+	}
+
+	if !ReadOnly && ApprovalMode == "" {
+		s.AddTool(beginTransactionTool, WithToolTimeout(beginTransactionTool.Name, func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			isolation, _ := request.GetArguments()["isolation_level"].(string)
+			stx, err := BeginSessionTx(ctx, isolation)
+			if err != nil {
+				return ErrorResult(err), nil
+			}
+
+			text := fmt.Sprintf("transaction started with isolation level %s. read_query, write_query, update_query and delete_query now run inside it until commit or rollback", stx.isolation)
+			if SessionTxTimeout > 0 {
+				text += fmt.Sprintf(", it is rolled back after being idle for %s", SessionTxTimeout)
+			}
+
+			return mcp.NewToolResultText(text), nil
+		}))
+
+		s.AddTool(commitTool, WithToolTimeout(commitTool.Name, func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			n, err := CommitSessionTx(ctx)
+			if err != nil {
+				return ErrorResult(err), nil
+			}
+
+			return mcp.NewToolResultText(fmt.Sprintf("transaction committed, %d write statements applied", n)), nil
+		}))
+
+		s.AddTool(rollbackTool, WithToolTimeout(rollbackTool.Name, func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			n, err := RollbackSessionTx(ctx)
+			if err != nil {
+				return ErrorResult(err), nil
+			}
+
+			return mcp.NewToolResultText(fmt.Sprintf("transaction rolled back, %d write statements discarded", n)), nil
+		}))
+	}
+
+	if !ReadOnly && ApprovalMode == ApprovalTool {
+		s.AddTool(approveStatementTool, WithToolTimeout(approveStatementTool.Name, func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			secret, _ := request.GetArguments()["secret"].(string)
+			if err := CheckApprovalSecret(secret); err != nil {
+				return ErrorResult(err), nil
+			}
+
+			token, _ := request.GetArguments()["token"].(string)
+			approval, err := ApproveStatement(ctx, token, SessionID(ctx))
+			if err != nil {
+				return ErrorResult(err), nil
+			}
+
+			return approval.StatusResult()
+		}))
+
+		s.AddTool(rejectStatementTool, WithToolTimeout(rejectStatementTool.Name, func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			secret, _ := request.GetArguments()["secret"].(string)
+			if err := CheckApprovalSecret(secret); err != nil {
+				return ErrorResult(err), nil
+			}
+
+			token, _ := request.GetArguments()["token"].(string)
+			reason, _ := request.GetArguments()["reason"].(string)
+			approval, err := RejectStatement(token, reason, SessionID(ctx))
+			if err != nil {
+				return ErrorResult(err), nil
+			}
+
+			return approval.StatusResult()
+		}))
+	}
+
+	if !ReadOnly && ApprovalMode != "" {
+		s.AddTool(approvalStatusTool, WithToolTimeout(approvalStatusTool.Name, func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			token, _ := request.GetArguments()["token"].(string)
+			approval, err := GetApproval(token)
+			if err != nil {
+				return ErrorResult(err), nil
+			}
+
+			return approval.StatusResult()
+		}))
+	}
+
+	// Resources
+	s.AddResource(mcp.NewResource(SchemasResourceURI, "schemas",
+		mcp.WithResourceDescription(T("gomcp.schemas_resource")),
+		mcp.WithMIMEType("application/json"),
+	), HandleSchemasResource)
+
+	s.AddResourceTemplate(mcp.NewResourceTemplate(TableSchemaTemplate, "table_schema",
+		mcp.WithTemplateDescription(T("gomcp.table_schema_resource")),
+	), HandleTableResource)
+
+	s.AddResourceTemplate(mcp.NewResourceTemplate(TableSampleTemplate, "table_sample",
+		mcp.WithTemplateDescription(T("gomcp.table_sample_resource")),
+		mcp.WithTemplateMIMEType("application/json"),
+	), HandleTableResource)
+
+	// Prompts
+	s.AddPrompt(mcp.NewPrompt("explore_schema",
+		mcp.WithPromptDescription(T("prompt.explore_schema")),
+		mcp.WithArgument("schema",
+			mcp.ArgumentDescription(T("prompt.explore_schema_schema")),
+		),
+	), HandleExploreSchemaPrompt)
+
+	s.AddPrompt(mcp.NewPrompt("safe_migration",
+		mcp.WithPromptDescription(T("prompt.safe_migration")),
+		mcp.WithArgument("table",
+			mcp.ArgumentDescription(T("prompt.table_argument")),
+			mcp.RequiredArgument(),
+		),
+		mcp.WithArgument("change",
+			mcp.ArgumentDescription(T("prompt.safe_migration_change")),
+			mcp.RequiredArgument(),
+		),
+		mcp.WithArgument("schema",
+			mcp.ArgumentDescription(T("gomcp.table_schema_description")),
+		),
+	), HandleSafeMigrationPrompt)
+
+	s.AddPrompt(mcp.NewPrompt("investigate_slow_query",
+		mcp.WithPromptDescription(T("prompt.investigate_slow_query")),
+		mcp.WithArgument("query",
+			mcp.ArgumentDescription(T("prompt.investigate_slow_query_query")),
+			mcp.RequiredArgument(),
+		),
+	), HandleSlowQueryPrompt)
+
+	s.AddPrompt(mcp.NewPrompt("table_report",
+		mcp.WithPromptDescription(T("prompt.table_report")),
+		mcp.WithArgument("table",
+			mcp.ArgumentDescription(T("prompt.table_argument")),
+			mcp.RequiredArgument(),
+		),
+		mcp.WithArgument("goal",
+			mcp.ArgumentDescription(T("prompt.table_report_goal")),
+		),
+		mcp.WithArgument("schema",
+			mcp.ArgumentDescription(T("gomcp.table_schema_description")),
+		),
+	), HandleTableReportPrompt)
+
+	s.AddPrompt(mcp.NewPrompt("data_quality_audit",
+		mcp.WithPromptDescription(T("prompt.data_quality_audit")),
+		mcp.WithArgument("table",
+			mcp.ArgumentDescription(T("prompt.table_argument")),
+			mcp.RequiredArgument(),
+		),
+		mcp.WithArgument("schema",
+			mcp.ArgumentDescription(T("gomcp.table_schema_description")),
+		),
+	), HandleDataQualityAuditPrompt)
+
+	if HealthCheckInterval > 0 {
+		go WatchDB(context.Background(), HealthCheckInterval)
+	}
+
+	if SchemaNotifyChannel != "" {
+		go ListenSchemaChanges(context.Background(), s, SchemaNotifyChannel)
+	}
+
+	// Only check for "sse" since stdio is the default
+	if Transport == "sse" {
+		sseServer := server.NewSSEServer(s, server.WithBaseURL(fmt.Sprintf("http://%s:%d", IPaddress, Port)))
+		//log.Printf("SSE server listening on : %d", Port)
+		mux := http.NewServeMux()
+		if ApprovalMode == ApprovalHTTP {
+			approvalHandler := ApprovalHandler()
+			mux.Handle("/approvals", approvalHandler)
+			mux.Handle("/approvals/", approvalHandler)
+		}
+		mux.Handle("/", WithSessionCleanup(sseServer))
+		if err := http.ListenAndServe(fmt.Sprintf("%s:%d", IPaddress, Port), mux); err != nil {
+			log.Fatalf("Server error: %v", err)
+		}
+	} else {
+		if err := server.ServeStdio(s); err != nil {
+			log.Fatalf("Server error: %v", err)
+		}
+	}
+
+}
+
+// GetDB returns the shared database handle, connecting on first use. The
+// connection attempts stop when ctx is done.
+func GetDB(ctx context.Context) (*sqlx.DB, error) {
+	dbMu.Lock()
+	defer dbMu.Unlock()
+
+	if DB != nil {
+		return DB, nil
+	}
+
+	pool, err := OpenPool(ctx, DSN)
+	if err != nil {
+		return nil, fmt.Errorf("failed to establish database connection: %v", err)
+	}
+
+	Pool = pool
+	DB = OpenDB(pool)
+
+	return DB, nil
+}
+
+// StreamQuery encodes at most limit rows of the query result as format, 0
+// means no row limit. Rows are written to the output as they are scanned.
+func StreamQuery(ctx context.Context, query, expect, format string, limit int, args ...interface{}) (*QueryPage, error) {
+	db, err := GetDB(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(expect) > 0 {
+		if err := CheckQuery(ctx, query, expect, args...); err != nil {
+			return nil, err
+		}
+	}
+
+	tx, err := BeginReadOnly(ctx, db)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	return readRows(ctx, tx, query, format, limit, args...)
+}
+
+// CheckQuery runs the statement classifier and the EXPLAIN based checks.
+func CheckQuery(ctx context.Context, query, expect string, args ...interface{}) error {
+	if err := CheckStatementType(query, expect); err != nil {
+		return err
+	}
+
+	return HandleExplain(ctx, query, expect, args...)
+}
+
+// HandleExec runs a statement in its own transaction, so that the per-call
+// timeouts apply to it.
+func HandleExec(ctx context.Context, query, expect string, args ...interface{}) (string, error) {
+	db, err := GetDB(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	if len(expect) > 0 {
+		if err := CheckQuery(ctx, query, expect, args...); err != nil {
+			return "", err
+		}
+	}
+
+	tx, err := BeginTx(ctx, db, nil)
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback()
+
+	result, err := execStatement(ctx, tx, query, args...)
+	if err != nil {
+		return "", err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return "", err
+	}
+
+	return result.Summary(), nil
+}
+
+// ExecResult is the outcome of a data-modifying statement.
+type ExecResult struct {
+	RowsAffected int64
+	// Page holds the rows returned by a RETURNING clause, nil without one.
+	Page *QueryPage
+	// Pending is set when the statement ran in a session transaction that
+	// is not committed yet.
+	Pending bool
+}
+
+// Summary reports the number of affected rows.
+func (r *ExecResult) Summary() string {
+	if r.Pending {
+		return fmt.Sprintf("%d rows affected, pending until commit", r.RowsAffected)
+	}
+
+	return fmt.Sprintf("%d rows affected", r.RowsAffected)
+}
+
+// ToolResult returns the summary. With a RETURNING clause the returned rows
+// and their page info follow, encoded like read_query does.
+func (r *ExecResult) ToolResult() (*mcp.CallToolResult, error) {
+	if r.Page == nil {
+		return mcp.NewToolResultText(r.Summary()), nil
+	}
+
+	page, err := PageResult(r.Page)
+	if err != nil {
+		return nil, err
+	}
+	page.Content = append([]mcp.Content{mcp.NewTextContent(r.Summary())}, page.Content...)
+
+	return page, nil
+}
+
+// HandleWrite runs an INSERT, UPDATE or DELETE, inside the session
+// transaction when one is open. The rows of a RETURNING clause are encoded
+// as format, at most limit of them are kept while all of them are counted as
+// affected.
+func HandleWrite(ctx context.Context, query, expect, format string, limit int, args ...interface{}) (*ExecResult, error) {
+	db, err := GetDB(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := CheckQuery(ctx, query, expect, args...); err != nil {
+		return nil, err
+	}
+
+	stx, err := SessionTx(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if stx != nil {
+		return stx.Write(ctx, query, format, limit, args...)
+	}
+
+	// the transaction applies the timeouts, and rolls the statement back
+	// when it changes too many rows
+	tx, err := BeginTx(ctx, db, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	result, err := execWrite(ctx, tx, query, format, limit, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// execQueryer is implemented by *sqlx.DB and *sqlx.Tx.
+type execQueryer interface {
+	sqlx.ExecerContext
+	sqlx.QueryerContext
+}
+
+// execWrite runs a data-modifying statement, reading the rows of its
+// RETURNING clause if it has one. It fails when an UPDATE or DELETE changed
+// more than MaxAffectedRows rows, db has to be a transaction then.
+func execWrite(ctx context.Context, db execQueryer, query, format string, limit int, args ...interface{}) (*ExecResult, error) {
+	stmts, err := ClassifyStatements(query)
+	if err != nil {
+		return nil, err
+	}
+	if len(stmts) != 1 {
+		return execStatement(ctx, db, query, args...)
+	}
+
+	var result *ExecResult
+	if stmts[0].Returning {
+		result, err = execReturning(ctx, db, query, format, limit, args...)
+	} else {
+		result, err = execStatement(ctx, db, query, args...)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := checkAffectedRows(stmts[0], result.RowsAffected); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+func execStatement(ctx context.Context, db sqlx.ExecerContext, query string, args ...interface{}) (*ExecResult, error) {
+	result, err := db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	ra, err := result.RowsAffected()
+	if err != nil {
+		return nil, err
+	}
+
+	return &ExecResult{RowsAffected: ra}, nil
+}
+
+// execReturning runs a statement with a RETURNING clause, which returns
+// one row per affected row.
+func execReturning(ctx context.Context, db sqlx.QueryerContext, query, format string, limit int, args ...interface{}) (*ExecResult, error) {
+	start := time.Now()
+	rows, err := db.QueryxContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	cols, err := ResultColumns(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	p := NewPageWriter(format, limit)
+	if err := p.WriteHeader(cols); err != nil {
+		return nil, err
+	}
+
+	rest, err := p.WriteRows(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	affected := int64(p.Rows)
+	if rest != nil {
+		// rows beyond the page are only counted
+		affected++
+		for rows.Next() {
+			affected++
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	output, err := p.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	return &ExecResult{
+		RowsAffected: affected,
+		Page: &QueryPage{
+			Columns:   cols,
+			Output:    output,
+			RowCount:  p.Rows,
+			Truncated: rest != nil,
+			Elapsed:   time.Since(start),
+		},
+	}, nil
+}
@@ -0,0 +1,245 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+const (
+	resourceUpdatedMethod     = "notifications/resources/updated"
+	resourceListChangedMethod = "notifications/resources/list_changed"
+
+	// schemaListenRetry is the pause before the schema change listener
+	// reconnects after losing its connection.
+	schemaListenRetry = 5 * time.Second
+)
+
+// SchemaNotifyChannel is the NOTIFY channel fed by the DDL event trigger,
+// empty disables the listener.
+var SchemaNotifyChannel string
+
+// Notifier sends notifications to the connected MCP clients, it is
+// implemented by server.MCPServer.
+type Notifier interface {
+	SendNotificationToAllClients(method string, params map[string]interface{})
+}
+
+var _ Notifier = (*server.MCPServer)(nil)
+
+// SchemaChange names a relation whose definition changed. Table is empty
+// when only the schema listing is affected, e.g. for a dropped function.
+type SchemaChange struct {
+	Schema string `json:"schema"`
+	Table  string `json:"table"`
+}
+
+// NotifySchemaChanges tells the clients to read the schemas resource and
+// the table resources of the changed relations again.
+func NotifySchemaChanges(n Notifier, database string, changes []SchemaChange) {
+	uris := []string{SchemasResourceURI}
+	seen := map[string]bool{}
+	for _, change := range changes {
+		if change.Table == "" || database == "" {
+			continue
+		}
+		for _, kind := range []string{"schema", "sample"} {
+			uri := TableResourceURI(database, change.Schema, change.Table, kind)
+			if !seen[uri] {
+				seen[uri] = true
+				uris = append(uris, uri)
+			}
+		}
+	}
+
+	for _, uri := range uris {
+		n.SendNotificationToAllClients(resourceUpdatedMethod, map[string]interface{}{"uri": uri})
+	}
+	n.SendNotificationToAllClients(resourceListChangedMethod, nil)
+}
+
+// NotifyDDL sends the notifications for a DDL query that was executed
+// through this server. Nothing is sent when the event trigger listener is
+// enabled, since it reports the same changes.
+func NotifyDDL(ctx context.Context, n Notifier, query string) {
+	if SchemaNotifyChannel != "" {
+		return
+	}
+
+	database, err := CurrentDatabase(ctx)
+	if err != nil {
+		log.Printf("failed to send schema change notifications: %v", err)
+		return
+	}
+
+	var changes []SchemaChange
+	for _, change := range DDLChanges(query) {
+		schema, table, err := ResolveRelation(ctx, change.Schema, change.Table)
+		if err != nil {
+			// dropped or renamed by a later statement of the query
+			continue
+		}
+		changes = append(changes, SchemaChange{Schema: schema, Table: table})
+	}
+
+	NotifySchemaChanges(n, database, changes)
+}
+
+// DDLChanges returns the relations created or altered by the CREATE and
+// ALTER statements of a query. Schema is empty for unqualified names.
+func DDLChanges(query string) []SchemaChange {
+	tokens, err := tokenize(query)
+	if err != nil {
+		return nil
+	}
+
+	var changes []SchemaChange
+	for _, stmt := range splitStatements(tokens) {
+		changes = append(changes, ddlTargets(query, stmt)...)
+	}
+
+	return changes
+}
+
+func ddlTargets(query string, tokens []token) []SchemaChange {
+	if len(tokens) == 0 || !tokens[0].isWord("CREATE", "ALTER") {
+		return nil
+	}
+
+	i := 1
+	for ; i < len(tokens) && !tokens[i].isWord("TABLE", "VIEW", "INDEX"); i++ {
+		if !tokens[i].isWord("OR", "REPLACE", "TEMP", "TEMPORARY", "UNLOGGED", "GLOBAL", "LOCAL",
+			"MATERIALIZED", "RECURSIVE", "FOREIGN", "UNIQUE") {
+			return nil
+		}
+	}
+	if i == len(tokens) {
+		return nil
+	}
+
+	if tokens[i].isWord("INDEX") {
+		if !tokens[0].isWord("CREATE") {
+			return nil
+		}
+		for i < len(tokens) && !tokens[i].isWord("ON") {
+			i++
+		}
+	}
+	i++
+	for i < len(tokens) && tokens[i].isWord("IF", "NOT", "EXISTS", "ONLY") {
+		i++
+	}
+
+	target, i, ok := qualifiedName(query, tokens, i)
+	if !ok {
+		return nil
+	}
+	changes := []SchemaChange{target}
+
+	// ALTER TABLE ... RENAME TO and SET SCHEMA move the relation
+	if i+2 < len(tokens) && tokens[i].isWord("RENAME") && tokens[i+1].isWord("TO") {
+		if name, ok := identName(query, tokens[i+2]); ok {
+			changes = append(changes, SchemaChange{Schema: target.Schema, Table: name})
+		}
+	}
+	if i+2 < len(tokens) && tokens[i].isWord("SET") && tokens[i+1].isWord("SCHEMA") {
+		if name, ok := identName(query, tokens[i+2]); ok {
+			changes = append(changes, SchemaChange{Schema: name, Table: target.Table})
+		}
+	}
+
+	return changes
+}
+
+// qualifiedName reads a possibly schema-qualified name at tokens[i] and
+// returns the index of the token after it.
+func qualifiedName(query string, tokens []token, i int) (SchemaChange, int, bool) {
+	if i >= len(tokens) {
+		return SchemaChange{}, i, false
+	}
+	first, ok := identName(query, tokens[i])
+	if !ok {
+		return SchemaChange{}, i, false
+	}
+
+	if i+2 < len(tokens) && tokens[i+1].is(tokenPunct, ".") {
+		if second, ok := identName(query, tokens[i+2]); ok {
+			return SchemaChange{Schema: first, Table: second}, i + 3, true
+		}
+	}
+
+	return SchemaChange{Table: first}, i + 1, true
+}
+
+// identName returns the name of an identifier token, unquoted names are
+// folded to lower case like PostgreSQL does.
+func identName(query string, t token) (string, bool) {
+	switch t.kind {
+	case tokenWord:
+		return strings.ToLower(query[t.start:t.end]), true
+	case tokenQuotedIdent:
+		return t.text, true
+	default:
+		return "", false
+	}
+}
+
+// ParseSchemaChange decodes the payload of a schema change notification,
+// payloads that are not JSON only refresh the schema listing.
+func ParseSchemaChange(payload string) []SchemaChange {
+	var change SchemaChange
+	if err := json.Unmarshal([]byte(payload), &change); err != nil {
+		return nil
+	}
+
+	return []SchemaChange{change}
+}
+
+// ListenSchemaChanges forwards the notifications sent on channel by the DDL
+// event trigger to the clients until ctx is done, reconnecting when the
+// connection is lost.
+func ListenSchemaChanges(ctx context.Context, n Notifier, channel string) {
+	for {
+		err := listenSchemaChanges(ctx, n, channel)
+		if ctx.Err() != nil {
+			return
+		}
+		log.Printf("schema change listener: %v, reconnecting in %s", err, schemaListenRetry)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(schemaListenRetry):
+		}
+	}
+}
+
+func listenSchemaChanges(ctx context.Context, n Notifier, channel string) error {
+	conn, err := pgx.Connect(ctx, DSN)
+	if err != nil {
+		return err
+	}
+	defer conn.Close(context.Background())
+
+	var database string
+	if err := conn.QueryRow(ctx, "SELECT current_database()").Scan(&database); err != nil {
+		return err
+	}
+
+	if _, err := conn.Exec(ctx, "LISTEN "+QuoteIdentifier(channel)); err != nil {
+		return err
+	}
+
+	for {
+		notification, err := conn.WaitForNotification(ctx)
+		if err != nil {
+			return err
+		}
+		NotifySchemaChanges(n, database, ParseSchemaChange(notification.Payload))
+	}
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+type sentNotification struct {
+	method string
+	params map[string]interface{}
+}
+
+type recordingNotifier struct {
+	sent []sentNotification
+}
+
+func (n *recordingNotifier) SendNotificationToAllClients(method string, params map[string]interface{}) {
+	n.sent = append(n.sent, sentNotification{method: method, params: params})
+}
+
+func TestDDLChanges(t *testing.T) {
+	tests := []struct {
+		query    string
+		expected []SchemaChange
+	}{
+		{"CREATE TABLE Orders (id int)", []SchemaChange{{Table: "orders"}}},
+		{`CREATE UNLOGGED TABLE IF NOT EXISTS sales."Order Items" (id int)`, []SchemaChange{{Schema: "sales", Table: "Order Items"}}},
+		{"CREATE OR REPLACE VIEW v AS SELECT 1", []SchemaChange{{Table: "v"}}},
+		{"CREATE UNIQUE INDEX CONCURRENTLY orders_idx ON ONLY sales.orders (id)", []SchemaChange{{Schema: "sales", Table: "orders"}}},
+		{"ALTER TABLE IF EXISTS ONLY orders ADD COLUMN note text; ALTER TABLE items RENAME TO lines",
+			[]SchemaChange{{Table: "orders"}, {Table: "items"}, {Table: "lines"}}},
+		{"ALTER TABLE public.orders SET SCHEMA sales", []SchemaChange{{Schema: "public", Table: "orders"}, {Schema: "sales", Table: "orders"}}},
+		{"ALTER INDEX orders_idx RENAME TO orders_id_idx", nil},
+		{"CREATE FUNCTION f() RETURNS int AS 'SELECT 1' LANGUAGE sql", nil},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.expected, DDLChanges(tt.query), tt.query)
+	}
+}
+
+func TestParseSchemaChange(t *testing.T) {
+	assert.Equal(t, []SchemaChange{{Schema: "sales", Table: "orders"}}, ParseSchemaChange(`{"schema":"sales","table":"orders"}`))
+	assert.Equal(t, []SchemaChange{{Schema: "public"}}, ParseSchemaChange(`{"schema":"public","table":null}`))
+	assert.Nil(t, ParseSchemaChange("sales.orders"))
+}
+
+func TestNotifyDDL(t *testing.T) {
+	_, mock, cleanup := setupMockDB(t)
+	defer cleanup()
+
+	// Setup mock expectations
+	mock.ExpectQuery("SELECT current_database()").
+		WillReturnRows(sqlmock.NewRows([]string{"current_database"}).AddRow("shop"))
+	mock.ExpectQuery("FROM pg_catalog.pg_class").WithArgs("", "orders").
+		WillReturnRows(sqlmock.NewRows([]string{"nspname", "relname"}).AddRow("sales", "orders"))
+	mock.ExpectQuery("FROM pg_catalog.pg_class").WithArgs("", "items").
+		WillReturnRows(sqlmock.NewRows([]string{"nspname", "relname"}))
+	mock.ExpectQuery("FROM pg_catalog.pg_class").WithArgs("", "lines").
+		WillReturnRows(sqlmock.NewRows([]string{"nspname", "relname"}).AddRow("sales", "lines"))
+
+	// Call NotifyDDL
+	notifier := &recordingNotifier{}
+	NotifyDDL(context.Background(), notifier, "ALTER TABLE orders ADD COLUMN note text; ALTER TABLE items RENAME TO lines")
+
+	// Verify results
+	assert.NoError(t, mock.ExpectationsWereMet())
+	assert.Equal(t, []sentNotification{
+		{resourceUpdatedMethod, map[string]interface{}{"uri": SchemasResourceURI}},
+		{resourceUpdatedMethod, map[string]interface{}{"uri": "postgres://shop/sales/orders/schema"}},
+		{resourceUpdatedMethod, map[string]interface{}{"uri": "postgres://shop/sales/orders/sample"}},
+		{resourceUpdatedMethod, map[string]interface{}{"uri": "postgres://shop/sales/lines/schema"}},
+		{resourceUpdatedMethod, map[string]interface{}{"uri": "postgres://shop/sales/lines/sample"}},
+		{resourceListChangedMethod, nil},
+	}, notifier.sent)
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/big"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	ParamTypeInt         = "int"
+	ParamTypeNumeric     = "numeric"
+	ParamTypeText        = "text"
+	ParamTypeBool        = "bool"
+	ParamTypeTimestamptz = "timestamptz"
+	ParamTypeJSONB       = "jsonb"
+	ParamTypeUUID        = "uuid"
+	ParamTypeBytea       = "bytea"
+)
+
+var uuidPattern = regexp.MustCompile(`^[0-9a-fA-F]{8}-?[0-9a-fA-F]{4}-?[0-9a-fA-F]{4}-?[0-9a-fA-F]{4}-?[0-9a-fA-F]{12}$`)
+
+// ParseParams converts the optional `params` tool argument into positional
+// bind arguments for $1..$n. Each element is either a plain JSON value or an
+// object of the form {"value": ..., "type": "<hint>"}.
+func ParseParams(raw interface{}) ([]interface{}, error) {
+	if raw == nil {
+		return nil, nil
+	}
+
+	list, ok := raw.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("params must be an array, got %T", raw)
+	}
+
+	args := make([]interface{}, len(list))
+	for i, item := range list {
+		arg, err := ParseParam(item)
+		if err != nil {
+			return nil, fmt.Errorf("invalid parameter $%d: %v", i+1, err)
+		}
+		args[i] = arg
+	}
+
+	return args, nil
+}
+
+// ParseParam converts a single element of the `params` argument.
+func ParseParam(item interface{}) (interface{}, error) {
+	if obj, ok := item.(map[string]interface{}); ok {
+		if typ, ok := obj["type"].(string); ok {
+			return ConvertParam(obj["value"], typ)
+		}
+	}
+
+	switch v := item.(type) {
+	case nil, bool, string:
+		return v, nil
+	case float64:
+		if v == math.Trunc(v) && math.Abs(v) < 1<<53 {
+			return int64(v), nil
+		}
+		return v, nil
+	default:
+		// objects and arrays are passed as JSON text, ready for json/jsonb columns
+		data, err := json.Marshal(v)
+		if err != nil {
+			return nil, err
+		}
+		return string(data), nil
+	}
+}
+
+// ConvertParam converts value according to the type hint.
+func ConvertParam(value interface{}, typ string) (interface{}, error) {
+	if value == nil {
+		return nil, nil
+	}
+
+	switch strings.ToLower(typ) {
+	case ParamTypeInt:
+		switch v := value.(type) {
+		case float64:
+			if v != math.Trunc(v) {
+				return nil, fmt.Errorf("%v is not an integer", v)
+			}
+			return int64(v), nil
+		case string:
+			return strconv.ParseInt(strings.TrimSpace(v), 10, 64)
+		}
+	case ParamTypeNumeric:
+		switch v := value.(type) {
+		case float64:
+			return strconv.FormatFloat(v, 'f', -1, 64), nil
+		case string:
+			// numeric values are sent as text so that no precision is lost
+			if _, ok := new(big.Float).SetString(strings.TrimSpace(v)); !ok {
+				return nil, fmt.Errorf("%q is not a valid numeric", v)
+			}
+			return strings.TrimSpace(v), nil
+		}
+	case ParamTypeText:
+		switch v := value.(type) {
+		case string:
+			return v, nil
+		case float64:
+			return strconv.FormatFloat(v, 'f', -1, 64), nil
+		case bool:
+			return strconv.FormatBool(v), nil
+		}
+	case ParamTypeBool:
+		switch v := value.(type) {
+		case bool:
+			return v, nil
+		case string:
+			return strconv.ParseBool(strings.TrimSpace(v))
+		}
+	case ParamTypeTimestamptz:
+		if v, ok := value.(string); ok {
+			t, err := time.Parse(time.RFC3339Nano, strings.TrimSpace(v))
+			if err != nil {
+				return nil, fmt.Errorf("%q is not an RFC 3339 timestamp", v)
+			}
+			return t, nil
+		}
+	case ParamTypeJSONB:
+		if v, ok := value.(string); ok {
+			// strings are taken as JSON documents
+			if !json.Valid([]byte(v)) {
+				return nil, fmt.Errorf("%q is not a valid JSON document", v)
+			}
+			return v, nil
+		}
+		data, err := json.Marshal(value)
+		if err != nil {
+			return nil, err
+		}
+		return string(data), nil
+	case ParamTypeUUID:
+		if v, ok := value.(string); ok {
+			if !uuidPattern.MatchString(strings.TrimSpace(v)) {
+				return nil, fmt.Errorf("%q is not a valid uuid", v)
+			}
+			return strings.TrimSpace(v), nil
+		}
+	case ParamTypeBytea:
+		if v, ok := value.(string); ok {
+			data, err := base64.StdEncoding.DecodeString(v)
+			if err != nil {
+				return nil, fmt.Errorf("bytea values must be base64 encoded: %v", err)
+			}
+			return data, nil
+		}
+	default:
+		return nil, fmt.Errorf("unsupported type %q", typ)
+	}
+
+	return nil, fmt.Errorf("cannot use %T value as %s", value, typ)
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseParams(t *testing.T) {
+	t.Run("no params", func(t *testing.T) {
+		args, err := ParseParams(nil)
+
+		assert.NoError(t, err)
+		assert.Nil(t, args)
+	})
+
+	t.Run("plain json values", func(t *testing.T) {
+		// Setup test data, decoded the same way as tool arguments
+		raw := []interface{}{float64(42), 3.5, "alice", true, nil, map[string]interface{}{"a": float64(1)}, []interface{}{"x", "y"}}
+
+		// Call ParseParams
+		args, err := ParseParams(raw)
+
+		// Verify results
+		assert.NoError(t, err)
+		assert.Equal(t, []interface{}{int64(42), 3.5, "alice", true, nil, `{"a":1}`, `["x","y"]`}, args)
+	})
+
+	t.Run("type hints", func(t *testing.T) {
+		// Setup test data
+		raw := []interface{}{
+			map[string]interface{}{"value": "42", "type": "int"},
+			map[string]interface{}{"value": "12345678901234567890.123456789", "type": "numeric"},
+			map[string]interface{}{"value": float64(7), "type": "text"},
+			map[string]interface{}{"value": "false", "type": "bool"},
+			map[string]interface{}{"value": "2024-05-01T10:30:00+02:00", "type": "timestamptz"},
+			map[string]interface{}{"value": map[string]interface{}{"tags": []interface{}{"a"}}, "type": "jsonb"},
+			map[string]interface{}{"value": `{"already": "json"}`, "type": "jsonb"},
+			map[string]interface{}{"value": "6f1c2f0e-3b0a-4c1d-9d5e-0a1b2c3d4e5f", "type": "uuid"},
+			map[string]interface{}{"value": "aGVsbG8=", "type": "bytea"},
+			map[string]interface{}{"value": nil, "type": "int"},
+		}
+
+		// Call ParseParams
+		args, err := ParseParams(raw)
+
+		// Verify results
+		assert.NoError(t, err)
+		assert.Len(t, args, 10)
+		assert.Equal(t, int64(42), args[0])
+		assert.Equal(t, "12345678901234567890.123456789", args[1])
+		assert.Equal(t, "7", args[2])
+		assert.Equal(t, false, args[3])
+		assert.True(t, time.Date(2024, 5, 1, 8, 30, 0, 0, time.UTC).Equal(args[4].(time.Time)))
+		assert.Equal(t, `{"tags":["a"]}`, args[5])
+		assert.Equal(t, `{"already": "json"}`, args[6])
+		assert.Equal(t, "6f1c2f0e-3b0a-4c1d-9d5e-0a1b2c3d4e5f", args[7])
+		assert.Equal(t, []byte("hello"), args[8])
+		assert.Nil(t, args[9])
+	})
+
+	t.Run("not an array", func(t *testing.T) {
+		_, err := ParseParams("1,2,3")
+
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "params must be an array")
+	})
+
+	t.Run("invalid values", func(t *testing.T) {
+		cases := []map[string]interface{}{
+			{"value": 1.5, "type": "int"},
+			{"value": "abc", "type": "numeric"},
+			{"value": "yesterday", "type": "timestamptz"},
+			{"value": "{broken", "type": "jsonb"},
+			{"value": "not-a-uuid", "type": "uuid"},
+			{"value": "***", "type": "bytea"},
+			{"value": true, "type": "int"},
+			{"value": "x", "type": "money"},
+		}
+
+		for _, c := range cases {
+			_, err := ParseParams([]interface{}{float64(1), c})
+
+			assert.Error(t, err, "%v", c)
+			assert.Contains(t, err.Error(), "invalid parameter $2")
+		}
+	})
+}
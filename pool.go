@@ -0,0 +1,193 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/jackc/pgx/v5/stdlib"
+	"github.com/jmoiron/sqlx"
+)
+
+const (
+	// connectBackoffMin and connectBackoffMax bound the pause between two
+	// connection attempts, which doubles after every failure.
+	connectBackoffMin = 250 * time.Millisecond
+	connectBackoffMax = 5 * time.Second
+
+	// resetAfterFailures is the number of consecutive failed health checks
+	// after which the pool is reset. A single failed ping may be a slow
+	// answer or a broken connection, which pgxpool replaces on its own.
+	resetAfterFailures = 3
+)
+
+var (
+	MaxOpenConns    int
+	MinIdleConns    int
+	ConnMaxLifetime time.Duration
+	ConnMaxIdleTime time.Duration
+
+	ConnectTimeout      time.Duration
+	HealthCheckInterval time.Duration
+
+	// Pool is the pgx connection pool behind DB.
+	Pool *pgxpool.Pool
+
+	// dbMu guards the lazy initialization of Pool and DB.
+	dbMu sync.Mutex
+)
+
+// healthChecker is the part of pgxpool.Pool used by the health checks.
+type healthChecker interface {
+	Ping(ctx context.Context) error
+	Reset()
+}
+
+// PoolConfig parses the DSN and applies the pool size and connection
+// lifetime flags.
+func PoolConfig(dsn string) (*pgxpool.Config, error) {
+	config, err := pgxpool.ParseConfig(dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	if MaxOpenConns > 0 {
+		config.MaxConns = int32(MaxOpenConns)
+	}
+	config.MinIdleConns = int32(MinIdleConns)
+	if config.MinIdleConns > config.MaxConns {
+		config.MinIdleConns = config.MaxConns
+	}
+	config.MaxConnLifetime = ConnMaxLifetime
+	config.MaxConnIdleTime = ConnMaxIdleTime
+	if HealthCheckInterval > 0 {
+		config.HealthCheckPeriod = HealthCheckInterval
+	}
+
+	return config, nil
+}
+
+// OpenPool creates the connection pool and pings the database until it
+// answers, see retryConnect.
+func OpenPool(ctx context.Context, dsn string) (*pgxpool.Pool, error) {
+	config, err := PoolConfig(dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	pool, err := pgxpool.NewWithConfig(ctx, config)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := retryConnect(ctx, pool.Ping); err != nil {
+		pool.Close()
+		return nil, err
+	}
+
+	return pool, nil
+}
+
+// OpenDB wraps the pool into a database/sql handle for the query helpers.
+// Connections stay owned by the pool, which also manages the idle ones.
+// Rows are still scanned through database/sql, so values arrive as the
+// driver.Value types: arrays, ranges and other composite values come as
+// their text form, which values.go converts, and COPY is not available.
+func OpenDB(pool *pgxpool.Pool) *sqlx.DB {
+	return sqlx.NewDb(stdlib.OpenDBFromPool(pool), "pgx")
+}
+
+// retryConnect calls ping until it succeeds, backing off exponentially
+// between attempts. It gives up once ConnectTimeout has passed, a zero
+// ConnectTimeout allows a single attempt.
+func retryConnect(ctx context.Context, ping func(ctx context.Context) error) error {
+	deadline := time.Now().Add(ConnectTimeout)
+	backoff := connectBackoffMin
+	for attempt := 1; ; attempt++ {
+		err := pingDB(ctx, ping, time.Until(deadline))
+		if err == nil {
+			return nil
+		}
+
+		wait := time.Until(deadline)
+		if wait <= 0 || ctx.Err() != nil {
+			return fmt.Errorf("no response after %d attempts: %v", attempt, err)
+		}
+		if backoff < wait {
+			wait = backoff
+		}
+		log.Printf("database connection attempt %d failed: %v, retrying in %s", attempt, err, wait)
+
+		select {
+		case <-ctx.Done():
+		case <-time.After(wait):
+		}
+		if backoff *= 2; backoff > connectBackoffMax {
+			backoff = connectBackoffMax
+		}
+	}
+}
+
+// pingDB pings the database, waiting at most timeout when it is positive.
+func pingDB(ctx context.Context, ping func(ctx context.Context) error, timeout time.Duration) error {
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	return ping(ctx)
+}
+
+// WatchDB pings the database every interval until ctx is done. When several
+// pings in a row fail all pooled connections are closed, so that once the
+// database is back the pool opens fresh connections instead of handing out
+// broken ones.
+func WatchDB(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	failures := 0
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		dbMu.Lock()
+		pool := Pool
+		dbMu.Unlock()
+		if pool == nil {
+			continue
+		}
+
+		failures = CheckDB(ctx, pool, interval, failures)
+	}
+}
+
+// CheckDB runs a single health check and returns the number of consecutive
+// failed checks, given the number before it. The pool is reset once
+// resetAfterFailures checks in a row failed. Changes of the health state are
+// logged.
+func CheckDB(ctx context.Context, pool healthChecker, timeout time.Duration, failures int) int {
+	if err := pingDB(ctx, pool.Ping, timeout); err != nil {
+		if failures == 0 {
+			log.Printf("database health check failed: %v", err)
+		}
+		failures++
+		if failures == resetAfterFailures {
+			log.Printf("database health check failed %d times in a row, closing all connections", failures)
+			pool.Reset()
+		}
+		return failures
+	}
+
+	if failures > 0 {
+		log.Printf("database connection restored")
+	}
+	return 0
+}
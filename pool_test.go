@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type fakePool struct {
+	pings  []error
+	resets int
+}
+
+func (p *fakePool) Ping(ctx context.Context) error {
+	err := p.pings[0]
+	p.pings = p.pings[1:]
+	return err
+}
+
+func (p *fakePool) Reset() {
+	p.resets++
+}
+
+func TestPoolConfig(t *testing.T) {
+	originalMaxOpen, originalMinIdle, originalLifetime := MaxOpenConns, MinIdleConns, ConnMaxLifetime
+	defer func() {
+		MaxOpenConns, MinIdleConns, ConnMaxLifetime = originalMaxOpen, originalMinIdle, originalLifetime
+	}()
+	MaxOpenConns, MinIdleConns, ConnMaxLifetime = 3, 5, time.Hour
+
+	// Call PoolConfig
+	config, err := PoolConfig("postgres://mcp@localhost:5432/shop?sslmode=disable")
+
+	// Verify results
+	assert.NoError(t, err)
+	assert.Equal(t, int32(3), config.MaxConns)
+	assert.Equal(t, int32(3), config.MinIdleConns)
+	assert.Equal(t, time.Hour, config.MaxConnLifetime)
+	assert.Equal(t, "shop", config.ConnConfig.Database)
+
+	_, err = PoolConfig("sqlmock")
+	assert.Error(t, err)
+}
+
+func TestRetryConnect(t *testing.T) {
+	originalTimeout := ConnectTimeout
+	defer func() { ConnectTimeout = originalTimeout }()
+
+	t.Run("retries until the database answers", func(t *testing.T) {
+		ConnectTimeout = 5 * time.Second
+		pool := &fakePool{pings: []error{
+			fmt.Errorf("the database system is starting up"),
+			fmt.Errorf("the database system is starting up"),
+			nil,
+		}}
+
+		// Call retryConnect
+		err := retryConnect(context.Background(), pool.Ping)
+
+		// Verify results
+		assert.NoError(t, err)
+		assert.Empty(t, pool.pings)
+	})
+
+	t.Run("single attempt without timeout", func(t *testing.T) {
+		ConnectTimeout = 0
+		pool := &fakePool{pings: []error{fmt.Errorf("connection refused"), nil}}
+
+		// Call retryConnect
+		err := retryConnect(context.Background(), pool.Ping)
+
+		// Verify results
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "no response after 1 attempts: connection refused")
+		assert.Len(t, pool.pings, 1)
+	})
+}
+
+func TestCheckDB(t *testing.T) {
+	t.Run("resets the pool after consecutive failures", func(t *testing.T) {
+		pool := &fakePool{pings: []error{
+			fmt.Errorf("server closed the connection unexpectedly"),
+			fmt.Errorf("connection refused"),
+			fmt.Errorf("connection refused"),
+			fmt.Errorf("connection refused"),
+			nil,
+		}}
+
+		// Call CheckDB
+		failures := 0
+		for i := 0; i < 4; i++ {
+			failures = CheckDB(context.Background(), pool, time.Second, failures)
+		}
+		assert.Equal(t, 4, failures)
+		failures = CheckDB(context.Background(), pool, time.Second, failures)
+
+		// Verify results
+		assert.Equal(t, 0, failures)
+		assert.Equal(t, 1, pool.resets)
+	})
+
+	t.Run("a single failed ping keeps the pool", func(t *testing.T) {
+		pool := &fakePool{pings: []error{
+			fmt.Errorf("timeout: context deadline exceeded"),
+			nil,
+			fmt.Errorf("timeout: context deadline exceeded"),
+		}}
+
+		// Call CheckDB
+		failures := CheckDB(context.Background(), pool, time.Second, 0)
+		assert.Equal(t, 1, failures)
+		failures = CheckDB(context.Background(), pool, time.Second, failures)
+		assert.Equal(t, 0, failures)
+		failures = CheckDB(context.Background(), pool, time.Second, failures)
+
+		// Verify results
+		assert.Equal(t, 1, failures)
+		assert.Equal(t, 0, pool.resets)
+	})
+}
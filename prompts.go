@@ -0,0 +1,202 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// promptSampleRows is the number of sample rows embedded in table prompts.
+const promptSampleRows = 10
+
+const relationSizeQuery = `SELECT CASE WHEN c.reltuples < 0 THEN NULL ELSE c.reltuples::bigint END AS estimated_rows,
+       pg_catalog.pg_size_pretty(pg_catalog.pg_total_relation_size(c.oid)) AS total_size
+FROM pg_catalog.pg_class c
+WHERE c.oid = ` + relationOID
+
+const columnStatsQuery = `SELECT a.attname AS column_name,
+       pg_catalog.format_type(a.atttypid, a.atttypmod) AS data_type,
+       NOT a.attnotnull AS nullable,
+       s.null_frac,
+       s.n_distinct,
+       s.most_common_vals::text AS most_common_vals
+FROM pg_catalog.pg_attribute a
+LEFT JOIN LATERAL (
+    SELECT st.null_frac, st.n_distinct, st.most_common_vals
+    FROM pg_catalog.pg_stats st
+    WHERE st.schemaname = $1 AND st.tablename = $2 AND st.attname = a.attname
+    ORDER BY st.inherited DESC
+    LIMIT 1
+) s ON true
+WHERE a.attrelid = ` + relationOID + ` AND a.attnum > 0 AND NOT a.attisdropped
+ORDER BY a.attnum`
+
+// promptResult wraps the text of a prompt into a single user message.
+func promptResult(description, text string) *mcp.GetPromptResult {
+	return mcp.NewGetPromptResult(description, []mcp.PromptMessage{
+		mcp.NewPromptMessage(mcp.RoleUser, mcp.NewTextContent(text)),
+	})
+}
+
+// promptRelation resolves the table and schema arguments of a prompt.
+func promptRelation(ctx context.Context, request mcp.GetPromptRequest) (string, string, error) {
+	return ResolveRelation(ctx, request.Params.Arguments["schema"], request.Params.Arguments["table"])
+}
+
+// HandleExploreSchemaPrompt embeds the relations of a schema, or of the whole
+// database when no schema is given.
+func HandleExploreSchemaPrompt(ctx context.Context, request mcp.GetPromptRequest) (*mcp.GetPromptResult, error) {
+	schema := request.Params.Arguments["schema"]
+
+	kinds, err := ParseRelationKinds(nil)
+	if err != nil {
+		return nil, err
+	}
+
+	tables, err := ListTables(ctx, schema, "", false, kinds, FormatMarkdown)
+	if err != nil {
+		return nil, err
+	}
+
+	return promptResult(T("prompt.explore_schema"), TData("prompt.explore_schema_message", map[string]interface{}{
+		"Schema": schema,
+		"Tables": tables.Output,
+	})), nil
+}
+
+// HandleSafeMigrationPrompt embeds the definition and size of the table to
+// migrate.
+func HandleSafeMigrationPrompt(ctx context.Context, request mcp.GetPromptRequest) (*mcp.GetPromptResult, error) {
+	schema, table, err := promptRelation(ctx, request)
+	if err != nil {
+		return nil, err
+	}
+
+	ddl, err := HandleDescTable(ctx, schema, table)
+	if err != nil {
+		return nil, err
+	}
+
+	size, err := StreamQuery(ctx, relationSizeQuery, StatementTypeNoExplainCheck, FormatMarkdown, 0, schema, table)
+	if err != nil {
+		return nil, err
+	}
+
+	return promptResult(T("prompt.safe_migration"), TData("prompt.safe_migration_message", map[string]interface{}{
+		"Table":  QualifiedName(schema, table),
+		"Change": request.Params.Arguments["change"],
+		"DDL":    strings.TrimSpace(ddl),
+		"Size":   size.Output,
+	})), nil
+}
+
+// HandleSlowQueryPrompt embeds the estimated plan of the query and the
+// definitions of the tables it reads. The query itself is not executed.
+func HandleSlowQueryPrompt(ctx context.Context, request mcp.GetPromptRequest) (*mcp.GetPromptResult, error) {
+	query := strings.TrimSpace(request.Params.Arguments["query"])
+
+	stmts, err := ClassifyStatements(query)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse query: %v", err)
+	}
+	if len(stmts) != 1 {
+		return nil, fmt.Errorf("expected a single statement, found %d", len(stmts))
+	}
+	switch stmts[0].Type() {
+	case StatementTypeSelect, StatementTypeInsert, StatementTypeUpdate, StatementTypeDelete:
+	default:
+		return nil, fmt.Errorf("statement classified as %s has no query plan", stmts[0].Type())
+	}
+	if stmts[0].Command == "EXPLAIN" {
+		return nil, fmt.Errorf("pass the query without EXPLAIN")
+	}
+
+	plan, err := ExplainJSON(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+
+	root, err := ParseExplainJSON(plan)
+	if err != nil {
+		return nil, err
+	}
+
+	var ddls []string
+	seen := map[string]bool{}
+	var walkErr error
+	root.Walk(func(node *PlanNode) {
+		if walkErr != nil || node.RelationName == "" || seen[node.QualifiedRelationName()] {
+			return
+		}
+		seen[node.QualifiedRelationName()] = true
+
+		ddl, err := HandleDescTable(ctx, node.Schema, node.RelationName)
+		if err != nil {
+			walkErr = err
+			return
+		}
+		ddls = append(ddls, strings.TrimSpace(ddl))
+	})
+	if walkErr != nil {
+		return nil, walkErr
+	}
+
+	return promptResult(T("prompt.investigate_slow_query"), TData("prompt.investigate_slow_query_message", map[string]interface{}{
+		"Query": query,
+		"Plan":  string(plan),
+		"DDL":   strings.Join(ddls, "\n\n"),
+	})), nil
+}
+
+// HandleTableReportPrompt embeds the definition and sample rows of a table.
+func HandleTableReportPrompt(ctx context.Context, request mcp.GetPromptRequest) (*mcp.GetPromptResult, error) {
+	schema, table, err := promptRelation(ctx, request)
+	if err != nil {
+		return nil, err
+	}
+
+	ddl, err := HandleDescTable(ctx, schema, table)
+	if err != nil {
+		return nil, err
+	}
+
+	query := fmt.Sprintf("SELECT * FROM %s LIMIT %d", QualifiedName(schema, table), promptSampleRows)
+	sample, err := StreamQuery(ctx, query, StatementTypeNoExplainCheck, FormatMarkdown, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	return promptResult(T("prompt.table_report"), TData("prompt.table_report_message", map[string]interface{}{
+		"Table":  QualifiedName(schema, table),
+		"Goal":   request.Params.Arguments["goal"],
+		"DDL":    strings.TrimSpace(ddl),
+		"Sample": sample.Output,
+	})), nil
+}
+
+// HandleDataQualityAuditPrompt embeds the definition of a table and the
+// planner statistics of its columns.
+func HandleDataQualityAuditPrompt(ctx context.Context, request mcp.GetPromptRequest) (*mcp.GetPromptResult, error) {
+	schema, table, err := promptRelation(ctx, request)
+	if err != nil {
+		return nil, err
+	}
+
+	ddl, err := HandleDescTable(ctx, schema, table)
+	if err != nil {
+		return nil, err
+	}
+
+	stats, err := StreamQuery(ctx, columnStatsQuery, StatementTypeNoExplainCheck, FormatMarkdown, 0, schema, table)
+	if err != nil {
+		return nil, err
+	}
+
+	return promptResult(T("prompt.data_quality_audit"), TData("prompt.data_quality_audit_message", map[string]interface{}{
+		"Table": QualifiedName(schema, table),
+		"DDL":   strings.TrimSpace(ddl),
+		"Stats": stats.Output,
+	})), nil
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/stretchr/testify/assert"
+)
+
+func promptRequest(arguments map[string]string) mcp.GetPromptRequest {
+	request := mcp.GetPromptRequest{}
+	request.Params.Arguments = arguments
+	return request
+}
+
+func promptText(t *testing.T, result *mcp.GetPromptResult) string {
+	assert.Len(t, result.Messages, 1)
+	assert.Equal(t, mcp.RoleUser, result.Messages[0].Role)
+	return result.Messages[0].Content.(mcp.TextContent).Text
+}
+
+func TestHandleExploreSchemaPrompt(t *testing.T) {
+	_, mock, cleanup := setupMockDB(t)
+	defer cleanup()
+
+	// Setup mock expectations
+	expectTx(mock)
+	mock.ExpectQuery("FROM pg_catalog.pg_class c").WithArgs("f,m,p,r,v", "sales", "", false).
+		WillReturnRows(sqlmock.NewRows([]string{"table_schema", "table_name", "kind", "estimated_rows", "total_bytes", "total_size", "comment"}).
+			AddRow("sales", "orders", "table", 1200, 81920, "80 kB", nil))
+	mock.ExpectRollback()
+
+	// Call HandleExploreSchemaPrompt
+	result, err := HandleExploreSchemaPrompt(context.Background(), promptRequest(map[string]string{"schema": "sales"}))
+
+	// Verify results
+	assert.NoError(t, err)
+	text := promptText(t, result)
+	assert.Contains(t, text, `the schema "sales" of this database`)
+	assert.Contains(t, text, "| sales | orders | table | 1200 | 81920 | 80 kB | NULL |")
+	assert.NoError(t, mock.ExpectationsWereMet())
+
+	t.Run("localized", func(t *testing.T) {
+		originalLocalizer := Localizer
+		Localizer = NewLocalizer("zh-CN")
+		defer func() { Localizer = originalLocalizer }()
+
+		// Setup mock expectations
+		expectTx(mock)
+		mock.ExpectQuery("FROM pg_catalog.pg_class c").WithArgs("f,m,p,r,v", "", "", false).
+			WillReturnRows(sqlmock.NewRows([]string{"table_schema", "table_name", "kind", "estimated_rows", "total_bytes", "total_size", "comment"}))
+		mock.ExpectRollback()
+
+		// Call HandleExploreSchemaPrompt
+		result, err := HandleExploreSchemaPrompt(context.Background(), promptRequest(nil))
+
+		// Verify results
+		assert.NoError(t, err)
+		assert.Contains(t, promptText(t, result), "我刚接触这个数据库")
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
+
+func TestHandleSlowQueryPrompt(t *testing.T) {
+	t.Run("rejected", func(t *testing.T) {
+		for _, query := range []string{"SELECT 1; DROP TABLE orders", "CREATE TABLE t (id int)", "EXPLAIN SELECT 1"} {
+			_, err := HandleSlowQueryPrompt(context.Background(), promptRequest(map[string]string{"query": query}))
+			assert.Error(t, err, query)
+		}
+	})
+
+	t.Run("plan", func(t *testing.T) {
+		_, mock, cleanup := setupMockDB(t)
+		defer cleanup()
+
+		plan := `[{"Plan": {"Node Type": "Seq Scan", "Relation Name": "orders", "Schema": "sales", "Total Cost": 1800, "Plan Rows": 12}}]`
+		relationColumns := []string{"relkind", "relpersistence", "relispartition", "relrowsecurity", "relforcerowsecurity",
+			"partition_key", "partition_bound", "view_definition", "server", "comment"}
+
+		// Setup mock expectations
+		expectTx(mock)
+		mock.ExpectQuery(`EXPLAIN \(FORMAT JSON, VERBOSE\) SELECT \* FROM orders WHERE status = 'new'`).
+			WillReturnRows(sqlmock.NewRows([]string{"QUERY PLAN"}).AddRow([]byte(plan)))
+		mock.ExpectRollback()
+		expectTx(mock)
+		mock.ExpectQuery("pg_get_partkeydef").WithArgs("sales", "orders").
+			WillReturnRows(sqlmock.NewRows(relationColumns).
+				AddRow("r", "p", false, false, false, nil, nil, nil, nil, nil))
+		mock.ExpectQuery("format_type").WithArgs("sales", "orders").
+			WillReturnRows(sqlmock.NewRows([]string{"name", "type", "not_null", "default_value", "identity", "generated", "collation", "comment"}).
+				AddRow("status", "text", false, nil, "", "", nil, nil))
+		mock.ExpectQuery("pg_inherits").WillReturnRows(sqlmock.NewRows([]string{"inhparent"}))
+		mock.ExpectQuery("pg_get_constraintdef").WillReturnRows(sqlmock.NewRows([]string{"name", "definition"}))
+		mock.ExpectQuery("pg_get_indexdef").WillReturnRows(sqlmock.NewRows([]string{"pg_get_indexdef"}))
+		mock.ExpectQuery("pg_get_triggerdef").WillReturnRows(sqlmock.NewRows([]string{"name", "definition", "disabled"}))
+		mock.ExpectQuery("pg_policy").WillReturnRows(sqlmock.NewRows([]string{"name", "permissive", "command", "roles", "using_expr", "check_expr"}))
+		mock.ExpectRollback()
+
+		// Call HandleSlowQueryPrompt
+		result, err := HandleSlowQueryPrompt(context.Background(), promptRequest(map[string]string{"query": "SELECT * FROM orders WHERE status = 'new'"}))
+
+		// Verify results
+		assert.NoError(t, err)
+		text := promptText(t, result)
+		assert.Contains(t, text, plan)
+		assert.Contains(t, text, "CREATE TABLE \"sales\".\"orders\" (\n    status text\n);")
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
@@ -0,0 +1,242 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+const (
+	// SchemasResourceURI lists the schemas and tables of the connected
+	// database, the empty host stands for the current database.
+	SchemasResourceURI = "postgres:///schemas"
+
+	TableSchemaTemplate = "postgres://{database}/{schema}/{table}/schema"
+	TableSampleTemplate = "postgres://{database}/{schema}/{table}/sample"
+
+	// resourceSampleRows is the number of rows served by the sample resource.
+	resourceSampleRows = 10
+)
+
+const columnDocsQuery = `SELECT a.attname AS column_name,
+       pg_catalog.format_type(a.atttypid, a.atttypmod) AS data_type,
+       NOT a.attnotnull AS nullable,
+       pg_catalog.pg_get_expr(d.adbin, d.adrelid) AS column_default,
+       pg_catalog.col_description(a.attrelid, a.attnum) AS comment
+FROM pg_catalog.pg_attribute a
+LEFT JOIN pg_catalog.pg_attrdef d ON d.adrelid = a.attrelid AND d.adnum = a.attnum
+WHERE a.attrelid = ` + relationOID + ` AND a.attnum > 0 AND NOT a.attisdropped
+ORDER BY a.attnum`
+
+const listSchemasQuery = `SELECT n.nspname AS schema_name,
+       pg_catalog.obj_description(n.oid, 'pg_namespace') AS comment
+FROM pg_catalog.pg_namespace n
+WHERE n.nspname NOT IN ('pg_catalog', 'information_schema')
+  AND n.nspname NOT LIKE 'pg\_toast%'
+  AND n.nspname NOT LIKE 'pg\_temp\_%'
+ORDER BY n.nspname`
+
+// SchemaListing is the content of the schemas resource.
+type SchemaListing struct {
+	Database string          `json:"database"`
+	Schemas  []SchemaSummary `json:"schemas"`
+	// Truncated is set when the listing exceeded --max-output-bytes.
+	Truncated bool `json:"truncated,omitempty"`
+}
+
+type SchemaSummary struct {
+	Name    string         `json:"name"`
+	Comment interface{}    `json:"comment"`
+	Tables  []TableSummary `json:"tables"`
+}
+
+type TableSummary struct {
+	Name          string      `json:"name"`
+	Kind          interface{} `json:"kind"`
+	EstimatedRows interface{} `json:"estimated_rows"`
+	Comment       interface{} `json:"comment"`
+	SchemaURI     string      `json:"schema_uri"`
+	SampleURI     string      `json:"sample_uri"`
+}
+
+// TableResourceURI returns the URI of the schema or sample resource of a
+// table.
+func TableResourceURI(database, schema, table, kind string) string {
+	return fmt.Sprintf("postgres://%s/%s/%s/%s",
+		url.PathEscape(database), url.PathEscape(schema), url.PathEscape(table), kind)
+}
+
+// ParseTableResourceURI splits a table resource URI into its parts.
+func ParseTableResourceURI(uri string) (database, schema, table, kind string, err error) {
+	rest := strings.TrimPrefix(uri, "postgres://")
+	parts := strings.Split(rest, "/")
+	if rest == uri || len(parts) != 4 {
+		return "", "", "", "", fmt.Errorf("invalid resource URI %q, expected postgres://{database}/{schema}/{table}/{schema|sample}", uri)
+	}
+
+	for i, part := range parts[:3] {
+		if parts[i], err = url.PathUnescape(part); err != nil {
+			return "", "", "", "", fmt.Errorf("invalid resource URI %q: %v", uri, err)
+		}
+	}
+
+	return parts[0], parts[1], parts[2], parts[3], nil
+}
+
+// CurrentDatabase returns the name of the connected database.
+func CurrentDatabase(ctx context.Context) (string, error) {
+	db, err := GetDB(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	var name string
+	if err := db.QueryRowxContext(ctx, "SELECT current_database()").Scan(&name); err != nil {
+		return "", err
+	}
+
+	return name, nil
+}
+
+// HandleSchemasResource serves the schemas of the database with their
+// tables and the URIs of the table resources.
+func HandleSchemasResource(ctx context.Context, request mcp.ReadResourceRequest) ([]mcp.ResourceContents, error) {
+	database, err := CurrentDatabase(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var schemas []struct {
+		Name    string      `json:"schema_name"`
+		Comment interface{} `json:"comment"`
+	}
+	page, err := StreamQuery(ctx, listSchemasQuery, StatementTypeNoExplainCheck, FormatJSON, 0)
+	if err != nil {
+		return nil, err
+	}
+	if err := decodeRows(page, &schemas); err != nil {
+		return nil, err
+	}
+	truncated := page.Truncated
+
+	kinds, err := ParseRelationKinds(nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var tables []struct {
+		Schema        string      `json:"table_schema"`
+		Name          string      `json:"table_name"`
+		Kind          interface{} `json:"kind"`
+		EstimatedRows interface{} `json:"estimated_rows"`
+		Comment       interface{} `json:"comment"`
+	}
+	page, err = StreamQuery(ctx, listTablesQuery, StatementTypeNoExplainCheck, FormatJSON, 0, strings.Join(kinds, ","), "", "", false)
+	if err != nil {
+		return nil, err
+	}
+	if err := decodeRows(page, &tables); err != nil {
+		return nil, err
+	}
+
+	listing := SchemaListing{Database: database, Schemas: []SchemaSummary{}, Truncated: truncated || page.Truncated}
+	index := map[string]int{}
+	for _, row := range schemas {
+		index[row.Name] = len(listing.Schemas)
+		listing.Schemas = append(listing.Schemas, SchemaSummary{Name: row.Name, Comment: row.Comment, Tables: []TableSummary{}})
+	}
+
+	for _, row := range tables {
+		i, ok := index[row.Schema]
+		if !ok {
+			continue
+		}
+
+		listing.Schemas[i].Tables = append(listing.Schemas[i].Tables, TableSummary{
+			Name:          row.Name,
+			Kind:          row.Kind,
+			EstimatedRows: row.EstimatedRows,
+			Comment:       row.Comment,
+			SchemaURI:     TableResourceURI(database, row.Schema, row.Name, "schema"),
+			SampleURI:     TableResourceURI(database, row.Schema, row.Name, "sample"),
+		})
+	}
+
+	data, err := json.MarshalIndent(listing, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+
+	return []mcp.ResourceContents{
+		mcp.TextResourceContents{URI: request.Params.URI, MIMEType: "application/json", Text: string(data)},
+	}, nil
+}
+
+// decodeRows decodes a page encoded as FormatJSON into v. Numbers are kept
+// as json.Number, so that large integers pass through unchanged.
+func decodeRows(page *QueryPage, v interface{}) error {
+	d := json.NewDecoder(strings.NewReader(page.Output))
+	d.UseNumber()
+	if err := d.Decode(v); err != nil {
+		return fmt.Errorf("failed to decode rows: %v", err)
+	}
+
+	return nil
+}
+
+// HandleTableResource serves the DDL and the column docs of a table for
+// .../schema URIs, and a sample of its rows for .../sample URIs.
+func HandleTableResource(ctx context.Context, request mcp.ReadResourceRequest) ([]mcp.ResourceContents, error) {
+	uri := request.Params.URI
+	database, schema, table, kind, err := ParseTableResourceURI(uri)
+	if err != nil {
+		return nil, err
+	}
+
+	current, err := CurrentDatabase(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if database != current {
+		return nil, fmt.Errorf("database %q is not served, this server is connected to %q", database, current)
+	}
+
+	schema, table, err = ResolveRelation(ctx, schema, table)
+	if err != nil {
+		return nil, err
+	}
+
+	switch kind {
+	case "schema":
+		ddl, err := HandleDescTable(ctx, schema, table)
+		if err != nil {
+			return nil, err
+		}
+
+		docs, err := StreamQuery(ctx, columnDocsQuery, StatementTypeNoExplainCheck, FormatMarkdown, 0, schema, table)
+		if err != nil {
+			return nil, err
+		}
+
+		return []mcp.ResourceContents{
+			mcp.TextResourceContents{URI: uri, MIMEType: "application/sql", Text: ddl},
+			mcp.TextResourceContents{URI: uri, MIMEType: "text/markdown", Text: docs.Output},
+		}, nil
+	case "sample":
+		query := fmt.Sprintf("SELECT * FROM %s LIMIT %d", QualifiedName(schema, table), resourceSampleRows)
+		page, err := StreamQuery(ctx, query, StatementTypeNoExplainCheck, FormatJSON, 0)
+		if err != nil {
+			return nil, err
+		}
+
+		return []mcp.ResourceContents{
+			mcp.TextResourceContents{URI: uri, MIMEType: "application/json", Text: page.Output},
+		}, nil
+	default:
+		return nil, fmt.Errorf("unknown table resource %q, expected schema or sample", kind)
+	}
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseTableResourceURI(t *testing.T) {
+	uri := TableResourceURI("shop", "sales", "order items", "schema")
+	assert.Equal(t, "postgres://shop/sales/order%20items/schema", uri)
+
+	database, schema, table, kind, err := ParseTableResourceURI(uri)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"shop", "sales", "order items", "schema"}, []string{database, schema, table, kind})
+
+	for _, invalid := range []string{"postgres://shop/sales/schema", "mysql://shop/sales/orders/schema"} {
+		_, _, _, _, err := ParseTableResourceURI(invalid)
+		assert.Error(t, err, invalid)
+	}
+}
+
+func TestHandleTableResource(t *testing.T) {
+	readRequest := func(uri string) mcp.ReadResourceRequest {
+		request := mcp.ReadResourceRequest{}
+		request.Params.URI = uri
+		return request
+	}
+
+	t.Run("sample", func(t *testing.T) {
+		_, mock, cleanup := setupMockDB(t)
+		defer cleanup()
+
+		// Setup mock expectations
+		mock.ExpectQuery("SELECT current_database()").
+			WillReturnRows(sqlmock.NewRows([]string{"current_database"}).AddRow("shop"))
+		mock.ExpectQuery("FROM pg_catalog.pg_class").WithArgs("sales", "orders").
+			WillReturnRows(sqlmock.NewRows([]string{"nspname", "relname"}).AddRow("sales", "orders"))
+		expectTx(mock)
+		mock.ExpectQuery(`SELECT \* FROM "sales"."orders" LIMIT 10`).
+			WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1).AddRow(2))
+		mock.ExpectRollback()
+
+		// Call HandleTableResource
+		contents, err := HandleTableResource(context.Background(), readRequest("postgres://shop/sales/orders/sample"))
+
+		// Verify results
+		assert.NoError(t, err)
+		assert.Len(t, contents, 1)
+		text := contents[0].(mcp.TextResourceContents)
+		assert.Equal(t, "application/json", text.MIMEType)
+		assert.JSONEq(t, `[{"id": 1}, {"id": 2}]`, text.Text)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("other database", func(t *testing.T) {
+		_, mock, cleanup := setupMockDB(t)
+		defer cleanup()
+
+		// Setup mock expectations
+		mock.ExpectQuery("SELECT current_database()").
+			WillReturnRows(sqlmock.NewRows([]string{"current_database"}).AddRow("shop"))
+
+		// Call HandleTableResource
+		_, err := HandleTableResource(context.Background(), readRequest("postgres://crm/public/users/schema"))
+
+		// Verify results
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), `database "crm" is not served`)
+	})
+}
+
+func TestHandleSchemasResource(t *testing.T) {
+	_, mock, cleanup := setupMockDB(t)
+	defer cleanup()
+
+	// Setup mock expectations
+	mock.ExpectQuery("SELECT current_database()").
+		WillReturnRows(sqlmock.NewRows([]string{"current_database"}).AddRow("shop"))
+	expectTx(mock)
+	mock.ExpectQuery("FROM pg_catalog.pg_namespace n").
+		WillReturnRows(sqlmock.NewRows([]string{"schema_name", "comment"}).
+			AddRow("public", "standard public schema").
+			AddRow("sales", nil))
+	mock.ExpectRollback()
+	expectTx(mock)
+	mock.ExpectQuery("FROM pg_catalog.pg_class c").WithArgs("f,m,p,r,v", "", "", false).
+		WillReturnRows(sqlmock.NewRows([]string{"table_schema", "table_name", "kind", "estimated_rows", "total_bytes", "total_size", "comment"}).
+			AddRow("sales", "orders", "table", 1200, 81920, "80 kB", nil))
+	mock.ExpectRollback()
+
+	// Call HandleSchemasResource
+	request := mcp.ReadResourceRequest{}
+	request.Params.URI = SchemasResourceURI
+	contents, err := HandleSchemasResource(context.Background(), request)
+
+	// Verify results
+	assert.NoError(t, err)
+	var listing SchemaListing
+	assert.NoError(t, json.Unmarshal([]byte(contents[0].(mcp.TextResourceContents).Text), &listing))
+	assert.Equal(t, "shop", listing.Database)
+	assert.Len(t, listing.Schemas, 2)
+	assert.Empty(t, listing.Schemas[0].Tables)
+	assert.Equal(t, "standard public schema", listing.Schemas[0].Comment)
+	assert.Equal(t, "orders", listing.Schemas[1].Tables[0].Name)
+	assert.EqualValues(t, 1200, listing.Schemas[1].Tables[0].EstimatedRows)
+	assert.False(t, listing.Truncated)
+	assert.Equal(t, "postgres://shop/sales/orders/schema", listing.Schemas[1].Tables[0].SchemaURI)
+	assert.Equal(t, "postgres://shop/sales/orders/sample", listing.Schemas[1].Tables[0].SampleURI)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,46 @@
+package main
+
+import "fmt"
+
+var (
+	// AllowUnfilteredWrites lets UPDATE and DELETE run without a WHERE
+	// clause.
+	AllowUnfilteredWrites bool
+
+	// MaxAffectedRows is the most rows a single UPDATE or DELETE may change,
+	// a statement changing more is rolled back. 0 disables the limit.
+	MaxAffectedRows int64
+)
+
+// AffectedRowsError reports an UPDATE or DELETE that was rolled back for
+// changing more than MaxAffectedRows rows.
+type AffectedRowsError struct {
+	Command string
+	// RowsAffected is the number of rows the statement would have changed.
+	RowsAffected int64
+	Limit        int64
+}
+
+func (e *AffectedRowsError) Error() string {
+	return fmt.Sprintf("%s would affect %d rows, more than the limit of %d, rolled back", e.Command, e.RowsAffected, e.Limit)
+}
+
+// limitsAffectedRows reports whether the number of rows the statement
+// changes is bounded by MaxAffectedRows.
+func limitsAffectedRows(stmt *Statement) bool {
+	if MaxAffectedRows <= 0 {
+		return false
+	}
+
+	return stmt.Command == StatementTypeUpdate || stmt.Command == StatementTypeDelete
+}
+
+// checkAffectedRows fails when the statement changed more rows than allowed.
+// The caller has to roll the statement back.
+func checkAffectedRows(stmt *Statement, affected int64) error {
+	if !limitsAffectedRows(stmt) || affected <= MaxAffectedRows {
+		return nil
+	}
+
+	return &AffectedRowsError{Command: stmt.Command, RowsAffected: affected, Limit: MaxAffectedRows}
+}
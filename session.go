@@ -0,0 +1,365 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"sync"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+const (
+	// stdioSessionID identifies the single session of the stdio transport.
+	stdioSessionID = "stdio"
+
+	// sessionSavepoint wraps every statement of a session transaction.
+	sessionSavepoint = "mcp_statement"
+)
+
+var (
+	// SessionTxTimeout is how long a session transaction may stay idle
+	// before it is rolled back, 0 disables the timeout.
+	SessionTxTimeout time.Duration
+
+	// MaxSessionTxs bounds the session transactions open at once, each pins
+	// a pooled connection. 0 disables the limit.
+	MaxSessionTxs int
+
+	sessionTxs = map[string]*sessionTx{}
+	// expiredSessions remembers the sessions whose transaction hit the idle
+	// timeout, so that their next statement fails instead of silently
+	// running in autocommit mode.
+	expiredSessions = map[string]bool{}
+	sessionTxsMu    sync.Mutex
+)
+
+// sessionTx is a transaction opened by begin_transaction. It pins its
+// connection to the MCP session until commit, rollback or the idle timeout.
+type sessionTx struct {
+	mu        sync.Mutex
+	session   string
+	tx        *sqlx.Tx
+	isolation string
+	timer     *time.Timer
+	used      time.Time
+	// statements counts the write statements that succeeded in the
+	// transaction.
+	statements int
+	closed     bool
+}
+
+// SessionID returns the ID of the MCP session the request belongs to, the
+// SSE session ID or "stdio".
+func SessionID(ctx context.Context) string {
+	if session := server.ClientSessionFromContext(ctx); session != nil {
+		return session.SessionID()
+	}
+
+	return stdioSessionID
+}
+
+// SessionTx returns the open transaction of the session of ctx, nil when
+// there is none. It fails when the transaction of the session was rolled
+// back by the idle timeout and neither commit, rollback nor
+// begin_transaction was called since.
+func SessionTx(ctx context.Context) (*sessionTx, error) {
+	sessionTxsMu.Lock()
+	defer sessionTxsMu.Unlock()
+
+	id := SessionID(ctx)
+	if expiredSessions[id] {
+		return nil, errSessionTxExpired()
+	}
+
+	return sessionTxs[id], nil
+}
+
+func errSessionTxExpired() error {
+	return fmt.Errorf("the transaction of this session was rolled back after being idle for %s, nothing was executed; call rollback, then begin_transaction to start over", SessionTxTimeout)
+}
+
+// takeSessionTx unregisters the transaction of the session of ctx for
+// commit and rollback.
+func takeSessionTx(ctx context.Context) (*sessionTx, error) {
+	sessionTxsMu.Lock()
+	defer sessionTxsMu.Unlock()
+
+	id := SessionID(ctx)
+	if expiredSessions[id] {
+		delete(expiredSessions, id)
+		return nil, errSessionTxExpired()
+	}
+
+	stx, ok := sessionTxs[id]
+	if !ok {
+		return nil, fmt.Errorf("no transaction is open in this session, call begin_transaction first")
+	}
+	delete(sessionTxs, id)
+
+	return stx, nil
+}
+
+// BeginSessionTx opens a transaction for the session of ctx. Until it is
+// committed or rolled back, read_query, write_query, update_query and
+// delete_query calls of the session run inside it.
+func BeginSessionTx(ctx context.Context, isolation string) (*sessionTx, error) {
+	name, level, err := ParseIsolationLevel(isolation)
+	if err != nil {
+		return nil, err
+	}
+
+	db, err := GetDB(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	id := SessionID(ctx)
+	sessionTxsMu.Lock()
+	defer sessionTxsMu.Unlock()
+	if _, ok := sessionTxs[id]; ok {
+		return nil, fmt.Errorf("a transaction is already open in this session, commit or roll it back first")
+	}
+	if MaxSessionTxs > 0 && len(sessionTxs) >= MaxSessionTxs {
+		return nil, fmt.Errorf("too many open transactions, at most %d are allowed, try again once one is committed or rolled back", MaxSessionTxs)
+	}
+	delete(expiredSessions, id)
+
+	// The transaction outlives this call, so it must not be rolled back
+	// when ctx is done.
+	tx, err := db.BeginTxx(context.Background(), &sql.TxOptions{Isolation: level})
+	if err != nil {
+		return nil, err
+	}
+
+	// the server side idle timeout only backs up the idle timer
+	idle := time.Duration(0)
+	if SessionTxTimeout > 0 {
+		idle = SessionTxTimeout + idleGrace
+	}
+	if err := setLocalTimeouts(ctx, tx, idle); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	stx := &sessionTx{session: id, tx: tx, isolation: name, used: time.Now()}
+	if SessionTxTimeout > 0 {
+		stx.timer = time.AfterFunc(SessionTxTimeout, stx.expire)
+	}
+	sessionTxs[id] = stx
+
+	return stx, nil
+}
+
+// CommitSessionTx commits the transaction of the session of ctx and returns
+// the number of statements it contained.
+func CommitSessionTx(ctx context.Context) (int, error) {
+	stx, err := takeSessionTx(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	stx.mu.Lock()
+	defer stx.mu.Unlock()
+	stx.close()
+
+	if err := stx.tx.Commit(); err != nil {
+		return 0, fmt.Errorf("commit failed, transaction rolled back: %v", err)
+	}
+
+	return stx.statements, nil
+}
+
+// RollbackSessionTx rolls back the transaction of the session of ctx and
+// returns the number of statements it discarded.
+func RollbackSessionTx(ctx context.Context) (int, error) {
+	stx, err := takeSessionTx(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	stx.mu.Lock()
+	defer stx.mu.Unlock()
+	stx.close()
+
+	if err := stx.tx.Rollback(); err != nil {
+		return 0, err
+	}
+
+	return stx.statements, nil
+}
+
+// expire rolls back the transaction once it was idle for SessionTxTimeout.
+func (s *sessionTx) expire() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed || time.Since(s.used) < SessionTxTimeout {
+		// used again while the timer fired
+		return
+	}
+
+	sessionTxsMu.Lock()
+	if sessionTxs[s.session] == s {
+		delete(sessionTxs, s.session)
+		expiredSessions[s.session] = true
+	}
+	sessionTxsMu.Unlock()
+
+	s.close()
+	s.tx.Rollback()
+	log.Printf("rolled back the transaction of session %s after being idle for %s", s.session, SessionTxTimeout)
+}
+
+// close stops the idle timeout, the caller must hold s.mu.
+func (s *sessionTx) close() {
+	if s.timer != nil {
+		s.timer.Stop()
+	}
+	s.closed = true
+}
+
+// run calls fn inside a savepoint, so that a failed statement is undone
+// without aborting the whole transaction, and restarts the idle timeout.
+func (s *sessionTx) run(ctx context.Context, fn func(tx *sqlx.Tx) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return fmt.Errorf("the transaction of this session is closed, nothing was executed")
+	}
+	s.used = time.Now()
+	if s.timer != nil {
+		s.timer.Reset(SessionTxTimeout)
+	}
+
+	if _, err := s.tx.ExecContext(ctx, "SAVEPOINT "+sessionSavepoint); err != nil {
+		return err
+	}
+
+	if err := fn(s.tx); err != nil {
+		// ctx may be the reason of the failure, the savepoint is still
+		// rolled back
+		if _, rbErr := s.tx.ExecContext(context.Background(), "ROLLBACK TO SAVEPOINT "+sessionSavepoint); rbErr != nil {
+			return fmt.Errorf("%v, and rolling back the statement failed: %v", err, rbErr)
+		}
+		return err
+	}
+
+	_, err := s.tx.ExecContext(ctx, "RELEASE SAVEPOINT "+sessionSavepoint)
+	return err
+}
+
+// Write runs a data-modifying statement inside the transaction.
+func (s *sessionTx) Write(ctx context.Context, query, format string, limit int, args ...interface{}) (*ExecResult, error) {
+	var result *ExecResult
+	err := s.run(ctx, func(tx *sqlx.Tx) error {
+		var err error
+		if result, err = execWrite(ctx, tx, query, format, limit, args...); err == nil {
+			s.statements++
+		}
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	result.Pending = true
+
+	return result, nil
+}
+
+// Read returns at most limit rows of a query inside the transaction, so it
+// sees the uncommitted changes. The query runs read only like outside of a
+// session transaction, so that the database rejects writes the statement
+// classifier missed. The result cannot be continued by a cursor.
+func (s *sessionTx) Read(ctx context.Context, query, format string, limit int, args ...interface{}) (*QueryPage, error) {
+	var page *QueryPage
+	err := s.run(ctx, func(tx *sqlx.Tx) error {
+		if _, err := tx.ExecContext(ctx, "SET LOCAL transaction_read_only = on"); err != nil {
+			return err
+		}
+
+		var err error
+		if page, err = readRows(ctx, tx, query, format, limit, args...); err != nil {
+			return err
+		}
+
+		// ends read only mode, a read has nothing to keep
+		_, err = tx.ExecContext(ctx, "ROLLBACK TO SAVEPOINT "+sessionSavepoint)
+		return err
+	})
+
+	return page, err
+}
+
+// CloseSession rolls back the transaction of a session that went away, e.g.
+// when the event stream of an SSE client closes.
+func CloseSession(id string) {
+	sessionTxsMu.Lock()
+	stx := sessionTxs[id]
+	delete(sessionTxs, id)
+	delete(expiredSessions, id)
+	sessionTxsMu.Unlock()
+	if stx == nil {
+		return
+	}
+
+	stx.mu.Lock()
+	defer stx.mu.Unlock()
+	if stx.closed {
+		return
+	}
+	stx.close()
+	stx.tx.Rollback()
+	log.Printf("rolled back the transaction of session %s, the session was closed", id)
+}
+
+// sessionIDPattern finds the session ID in the endpoint event that starts
+// the event stream of an SSE client.
+var sessionIDPattern = regexp.MustCompile(`sessionId=([0-9A-Za-z-]+)`)
+
+// WithSessionCleanup wraps the SSE server and calls CloseSession once the
+// event stream of a client ends.
+func WithSessionCleanup(sse http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			sse.ServeHTTP(w, r)
+			return
+		}
+
+		sw := &sessionWriter{ResponseWriter: w}
+		sse.ServeHTTP(sw, r)
+		if sw.session != "" {
+			CloseSession(sw.session)
+		}
+	})
+}
+
+// sessionWriter remembers the session ID announced at the start of an event
+// stream.
+type sessionWriter struct {
+	http.ResponseWriter
+	session string
+	head    []byte
+}
+
+func (w *sessionWriter) Write(b []byte) (int, error) {
+	// the endpoint event is the first one of the stream
+	if w.session == "" && len(w.head) < 1024 {
+		w.head = append(w.head, b...)
+		if m := sessionIDPattern.FindSubmatch(w.head); m != nil {
+			w.session, w.head = string(m[1]), nil
+		}
+	}
+
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *sessionWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+// expectSessionBegin sets up the transaction BeginSessionTx opens
+func expectSessionBegin(mock sqlmock.Sqlmock) {
+	mock.ExpectBegin()
+	mock.ExpectExec("set_config").
+		WithArgs(timeoutSetting(StatementTimeout), timeoutSetting(LockTimeout), timeoutSetting(SessionTxTimeout+idleGrace)).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+}
+
+func TestSessionTx(t *testing.T) {
+	_, mock, cleanup := setupMockDB(t)
+	defer cleanup()
+
+	originalTimeout := SessionTxTimeout
+	defer func() { SessionTxTimeout = originalTimeout }()
+	SessionTxTimeout = time.Minute
+	ctx := context.Background()
+
+	t.Run("staged writes are committed", func(t *testing.T) {
+		// Setup mock expectations
+		expectSessionBegin(mock)
+		mock.ExpectExec("^SAVEPOINT mcp_statement$").WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectExec("UPDATE accounts").WithArgs(int64(1)).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec("^RELEASE SAVEPOINT mcp_statement$").WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectExec("^SAVEPOINT mcp_statement$").WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectExec("^SET LOCAL transaction_read_only = on$").WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectQuery("SELECT balance").WillReturnRows(sqlmock.NewRows([]string{"balance"}).AddRow(0))
+		mock.ExpectExec("^ROLLBACK TO SAVEPOINT mcp_statement$").WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectExec("^RELEASE SAVEPOINT mcp_statement$").WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectCommit()
+
+		// Call BeginSessionTx, HandleWrite, ReadQuery and CommitSessionTx
+		stx, err := BeginSessionTx(ctx, "")
+		assert.NoError(t, err)
+		assert.Equal(t, "read_committed", stx.isolation)
+
+		_, err = BeginSessionTx(ctx, "")
+		assert.Error(t, err)
+
+		result, err := HandleWrite(ctx, "UPDATE accounts SET balance = 0 WHERE id = $1", StatementTypeUpdate, FormatCSV, 10, int64(1))
+		assert.NoError(t, err)
+		assert.Equal(t, "1 rows affected, pending until commit", result.Summary())
+
+		page, err := ReadQuery(ctx, "SELECT balance FROM accounts WHERE id = 1", FormatCSV, 10)
+		assert.NoError(t, err)
+		assert.Equal(t, "balance\n0\n", page.Output)
+		assert.Empty(t, page.Cursor)
+
+		n, err := CommitSessionTx(ctx)
+
+		// Verify results
+		assert.NoError(t, err)
+		assert.Equal(t, 1, n)
+		stx, err = SessionTx(ctx)
+		assert.NoError(t, err)
+		assert.Nil(t, stx)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("failed statement keeps the transaction usable", func(t *testing.T) {
+		// Setup mock expectations
+		expectSessionBegin(mock)
+		mock.ExpectExec("^SAVEPOINT mcp_statement$").WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectExec("DELETE FROM accounts").WillReturnError(fmt.Errorf("violates foreign key constraint"))
+		mock.ExpectExec("^ROLLBACK TO SAVEPOINT mcp_statement$").WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectRollback()
+
+		// Call BeginSessionTx, HandleWrite and RollbackSessionTx
+		_, err := BeginSessionTx(ctx, "serializable")
+		assert.NoError(t, err)
+
+		_, err = HandleWrite(ctx, "DELETE FROM accounts WHERE id = 1", StatementTypeDelete, FormatCSV, 10)
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "violates foreign key constraint")
+
+		n, err := RollbackSessionTx(ctx)
+
+		// Verify results
+		assert.NoError(t, err)
+		assert.Equal(t, 0, n)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("idle transaction is rolled back", func(t *testing.T) {
+		SessionTxTimeout = 20 * time.Millisecond
+
+		// Setup mock expectations
+		expectSessionBegin(mock)
+		mock.ExpectRollback()
+
+		// Call BeginSessionTx and wait for the idle timeout
+		_, err := BeginSessionTx(ctx, "")
+		assert.NoError(t, err)
+		time.Sleep(100 * time.Millisecond)
+
+		// Verify results
+		_, err = HandleWrite(ctx, "DELETE FROM accounts WHERE id = 1", StatementTypeDelete, FormatCSV, 10)
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "rolled back after being idle for 20ms")
+
+		_, err = RollbackSessionTx(ctx)
+		assert.Error(t, err)
+		_, err = RollbackSessionTx(ctx)
+		assert.Contains(t, err.Error(), "no transaction is open")
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("closed SSE session is rolled back", func(t *testing.T) {
+		SessionTxTimeout = time.Minute
+		session := sessionContext("3f2a9c4e-1b7d-4e7a-9a51-7c0d2b8e6f10")
+
+		// Setup mock expectations
+		expectSessionBegin(mock)
+		mock.ExpectRollback()
+
+		// Call BeginSessionTx, then end the event stream of the session
+		_, err := BeginSessionTx(session, "")
+		assert.NoError(t, err)
+
+		sse := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte("event: endpoint\ndata: http://localhost:8080/message?sessionId=3f2a9c4e-1b7d-4e7a-9a51-7c0d2b8e6f10\n\n"))
+			w.(http.Flusher).Flush()
+		})
+		WithSessionCleanup(sse).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/sse", nil))
+
+		// Verify results
+		stx, err := SessionTx(session)
+		assert.NoError(t, err)
+		assert.Nil(t, stx)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("open transactions are limited", func(t *testing.T) {
+		originalMax := MaxSessionTxs
+		defer func() { MaxSessionTxs = originalMax }()
+		MaxSessionTxs = 2
+
+		// Setup mock expectations
+		expectSessionBegin(mock)
+		expectSessionBegin(mock)
+		mock.ExpectRollback()
+		expectSessionBegin(mock)
+		mock.ExpectRollback()
+		mock.ExpectRollback()
+
+		// Call BeginSessionTx from three sessions
+		_, err := BeginSessionTx(sessionContext("a"), "")
+		assert.NoError(t, err)
+		_, err = BeginSessionTx(sessionContext("b"), "")
+		assert.NoError(t, err)
+		_, err = BeginSessionTx(sessionContext("c"), "")
+
+		// Verify results
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "too many open transactions, at most 2 are allowed")
+
+		_, err = RollbackSessionTx(sessionContext("a"))
+		assert.NoError(t, err)
+		_, err = BeginSessionTx(sessionContext("c"), "")
+		assert.NoError(t, err)
+
+		_, err = RollbackSessionTx(sessionContext("b"))
+		assert.NoError(t, err)
+		_, err = RollbackSessionTx(sessionContext("c"))
+		assert.NoError(t, err)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
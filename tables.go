@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// relationKinds maps the kind names used by list_table to pg_class.relkind.
+var relationKinds = map[string]string{
+	"table":             "r",
+	"partitioned_table": "p",
+	"view":              "v",
+	"materialized_view": "m",
+	"foreign_table":     "f",
+}
+
+const listTablesQuery = `SELECT n.nspname AS table_schema,
+       c.relname AS table_name,
+       CASE c.relkind
+         WHEN 'r' THEN 'table'
+         WHEN 'p' THEN 'partitioned_table'
+         WHEN 'v' THEN 'view'
+         WHEN 'm' THEN 'materialized_view'
+         WHEN 'f' THEN 'foreign_table'
+       END AS kind,
+       CASE WHEN c.reltuples < 0 THEN NULL ELSE c.reltuples::bigint END AS estimated_rows,
+       pg_catalog.pg_total_relation_size(c.oid) AS total_bytes,
+       pg_catalog.pg_size_pretty(pg_catalog.pg_total_relation_size(c.oid)) AS total_size,
+       pg_catalog.obj_description(c.oid, 'pg_class') AS comment
+FROM pg_catalog.pg_class c
+JOIN pg_catalog.pg_namespace n ON n.oid = c.relnamespace
+WHERE c.relkind::text = ANY (string_to_array($1, ','))
+  AND ($2 = '' OR n.nspname = $2)
+  AND ($3 = '' OR c.relname ILIKE $3)
+  AND ($4 OR (n.nspname NOT IN ('pg_catalog', 'information_schema')
+              AND n.nspname NOT LIKE 'pg\_toast%'
+              AND n.nspname NOT LIKE 'pg\_temp\_%'))
+ORDER BY n.nspname, c.relname`
+
+// ParseRelationKinds converts the kinds argument of list_table into relkind
+// codes. All kinds are listed when none are given.
+func ParseRelationKinds(raw interface{}) ([]string, error) {
+	var names []string
+	switch v := raw.(type) {
+	case nil:
+	case []interface{}:
+		for _, elem := range v {
+			name, ok := elem.(string)
+			if !ok {
+				return nil, fmt.Errorf("kinds must be an array of strings")
+			}
+			names = append(names, name)
+		}
+	default:
+		return nil, fmt.Errorf("kinds must be an array of strings")
+	}
+
+	if len(names) == 0 {
+		for name := range relationKinds {
+			names = append(names, name)
+		}
+	}
+
+	var kinds []string
+	for _, name := range names {
+		kind, ok := relationKinds[strings.ToLower(name)]
+		if !ok {
+			return nil, fmt.Errorf("unknown relation kind %q, expected table, partitioned_table, view, materialized_view or foreign_table", name)
+		}
+		kinds = append(kinds, kind)
+	}
+	sort.Strings(kinds)
+
+	return kinds, nil
+}
+
+// ListTables lists the relations of the given kinds, optionally restricted to
+// one schema and to names matching an ILIKE pattern. System schemas are left
+// out unless includeSystem is set.
+func ListTables(ctx context.Context, schema, pattern string, includeSystem bool, kinds []string, format string) (*QueryPage, error) {
+	return StreamQuery(ctx, listTablesQuery, StatementTypeNoExplainCheck, format, 0,
+		strings.Join(kinds, ","), schema, pattern, includeSystem)
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseRelationKinds(t *testing.T) {
+	kinds, err := ParseRelationKinds(nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"f", "m", "p", "r", "v"}, kinds)
+
+	kinds, err = ParseRelationKinds([]interface{}{"View", "table"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"r", "v"}, kinds)
+
+	_, err = ParseRelationKinds([]interface{}{"index"})
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), `unknown relation kind "index"`)
+
+	_, err = ParseRelationKinds("table")
+	assert.Error(t, err)
+}
+
+func TestListTables(t *testing.T) {
+	_, mock, cleanup := setupMockDB(t)
+	defer cleanup()
+
+	// Setup mock expectations
+	rows := sqlmock.NewRows([]string{"table_schema", "table_name", "kind", "estimated_rows", "total_bytes", "total_size", "comment"}).
+		AddRow("sales", "orders", "table", 1200, 81920, "80 kB", "Customer orders").
+		AddRow("sales", "orders_2024", "table", nil, 8192, "8192 bytes", nil)
+
+	expectTx(mock)
+	mock.ExpectQuery("FROM pg_catalog.pg_class c").
+		WithArgs("p,r", "sales", "order%", false).
+		WillReturnRows(rows)
+	mock.ExpectRollback()
+
+	// Call ListTables
+	page, err := ListTables(context.Background(), "sales", "order%", false, []string{"p", "r"}, FormatCSV)
+
+	// Verify results
+	assert.NoError(t, err)
+	assert.Equal(t, 2, page.RowCount)
+	assert.Equal(t, "table_schema,table_name,kind,estimated_rows,total_bytes,total_size,comment\n"+
+		"sales,orders,table,1200,81920,80 kB,Customer orders\n"+
+		"sales,orders_2024,table,,8192,8192 bytes,\n", page.Output)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
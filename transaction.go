@@ -0,0 +1,246 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// isolationLevels maps the isolation_level argument of the transaction tool.
+var isolationLevels = map[string]sql.IsolationLevel{
+	"read_committed":  sql.LevelReadCommitted,
+	"repeatable_read": sql.LevelRepeatableRead,
+	"serializable":    sql.LevelSerializable,
+}
+
+// txStatementTypes maps the type argument of a transaction statement.
+var txStatementTypes = map[string]string{
+	"select": StatementTypeSelect,
+	"insert": StatementTypeInsert,
+	"update": StatementTypeUpdate,
+	"delete": StatementTypeDelete,
+}
+
+// TxStatement is a single statement of a transaction tool call.
+type TxStatement struct {
+	Query  string
+	Params []interface{}
+	// Expect is a StatementType* constant, taken from the classifier when
+	// the call does not name it.
+	Expect string
+}
+
+// TxStatementResult reports the outcome of one statement of a transaction.
+type TxStatementResult struct {
+	Index        int        `json:"index"`
+	Type         string     `json:"type"`
+	RowsAffected int64      `json:"rows_affected"`
+	Result       *PageInfo  `json:"result,omitempty"`
+	Error        *ToolError `json:"error,omitempty"`
+
+	output string
+}
+
+// TxResult reports the outcome of a transaction tool call. Statements lists
+// the statements that ran, up to and including a failed one.
+type TxResult struct {
+	Committed      bool                `json:"committed"`
+	IsolationLevel string              `json:"isolation_level"`
+	Statements     []TxStatementResult `json:"statements"`
+}
+
+// ParseIsolationLevel converts the isolation_level argument, read_committed
+// is the default.
+func ParseIsolationLevel(raw interface{}) (string, sql.IsolationLevel, error) {
+	name, _ := raw.(string)
+	if name == "" {
+		name = "read_committed"
+	}
+	name = strings.ToLower(strings.ReplaceAll(strings.TrimSpace(name), " ", "_"))
+
+	level, ok := isolationLevels[name]
+	if !ok {
+		return "", 0, fmt.Errorf("unknown isolation level %q, expected read_committed, repeatable_read or serializable", name)
+	}
+
+	return name, level, nil
+}
+
+// ParseTxStatements converts the statements argument of the transaction
+// tool and checks every statement before anything is executed.
+func ParseTxStatements(raw interface{}) ([]TxStatement, error) {
+	items, ok := raw.([]interface{})
+	if !ok || len(items) == 0 {
+		return nil, fmt.Errorf("statements must be a non-empty array")
+	}
+
+	stmts := make([]TxStatement, 0, len(items))
+	for i, item := range items {
+		obj, ok := item.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("statement %d: expected an object with query, params and type", i+1)
+		}
+
+		query, _ := obj["query"].(string)
+		if strings.TrimSpace(query) == "" {
+			return nil, fmt.Errorf("statement %d: query is required", i+1)
+		}
+
+		params, err := ParseParams(obj["params"])
+		if err != nil {
+			return nil, fmt.Errorf("statement %d: %v", i+1, err)
+		}
+
+		expect, err := txStatementType(query, obj["type"])
+		if err != nil {
+			return nil, fmt.Errorf("statement %d: %v", i+1, err)
+		}
+
+		if err := CheckStatementType(query, expect); err != nil {
+			return nil, fmt.Errorf("statement %d: %v", i+1, err)
+		}
+
+		stmts = append(stmts, TxStatement{Query: query, Params: params, Expect: expect})
+	}
+
+	return stmts, nil
+}
+
+// txStatementType returns the expected type of a statement, classifying it
+// when the type argument is omitted.
+func txStatementType(query string, raw interface{}) (string, error) {
+	if name, _ := raw.(string); name != "" {
+		expect, ok := txStatementTypes[strings.ToLower(name)]
+		if !ok {
+			return "", fmt.Errorf("unknown statement type %q, expected select, insert, update or delete", name)
+		}
+		return expect, nil
+	}
+
+	stmts, err := ClassifyStatements(query)
+	if err != nil {
+		return "", fmt.Errorf("unable to parse query: %v, denied", err)
+	}
+	if len(stmts) != 1 {
+		return "", fmt.Errorf("multiple statements are not allowed, found %d, denied", len(stmts))
+	}
+
+	got := stmts[0].Type()
+	if _, ok := txStatementTypes[strings.ToLower(got)]; !ok {
+		return "", fmt.Errorf("statement classified as %s is not allowed in a transaction, denied", got)
+	}
+
+	return got, nil
+}
+
+// RunTransaction runs the statements in a single transaction and commits it
+// when all of them succeed. On the first failure the transaction is rolled
+// back and the error is returned together with the results so far. Rows of
+// SELECT and RETURNING are encoded as format, at most limit per statement.
+func RunTransaction(ctx context.Context, stmts []TxStatement, isolation, format string, limit int) (*TxResult, error) {
+	name, level, err := ParseIsolationLevel(isolation)
+	if err != nil {
+		return nil, err
+	}
+
+	db, err := GetDB(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := BeginTx(ctx, db, &sql.TxOptions{Isolation: level})
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	result := &TxResult{IsolationLevel: name}
+	for i, stmt := range stmts {
+		res, err := runTxStatement(ctx, tx, stmt, format, limit)
+		res.Index = i + 1
+		if err != nil {
+			res.Error = NewToolError(err)
+			result.Statements = append(result.Statements, *res)
+			return result, fmt.Errorf("statement %d failed, transaction rolled back: %v", i+1, err)
+		}
+		result.Statements = append(result.Statements, *res)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return result, fmt.Errorf("commit failed, transaction rolled back: %v", err)
+	}
+	result.Committed = true
+
+	return result, nil
+}
+
+func runTxStatement(ctx context.Context, tx *sqlx.Tx, stmt TxStatement, format string, limit int) (*TxStatementResult, error) {
+	res := &TxStatementResult{Type: stmt.Expect}
+	if err := HandleExplain(ctx, stmt.Query, stmt.Expect, stmt.Params...); err != nil {
+		return res, err
+	}
+
+	if stmt.Expect == StatementTypeSelect {
+		page, err := readRows(ctx, tx, stmt.Query, format, limit, stmt.Params...)
+		if err != nil {
+			return res, err
+		}
+		info := NewPageInfo(page)
+		res.Result, res.output = &info, page.Output
+		return res, nil
+	}
+
+	exec, err := execWrite(ctx, tx, stmt.Query, format, limit, stmt.Params...)
+	if err != nil {
+		return res, err
+	}
+	res.RowsAffected = exec.RowsAffected
+	if exec.Page != nil {
+		info := NewPageInfo(exec.Page)
+		res.Result, res.output = &info, exec.Page.Output
+	}
+
+	return res, nil
+}
+
+// Text renders the statement result for the model to read: a summary line
+// followed by the encoded rows, if any.
+func (r *TxStatementResult) Text() string {
+	summary := fmt.Sprintf("statement %d (%s): %d rows affected", r.Index, r.Type, r.RowsAffected)
+	if r.Type == StatementTypeSelect {
+		summary = fmt.Sprintf("statement %d (%s): %d rows", r.Index, r.Type, r.Result.RowCount)
+	}
+	if r.output == "" {
+		return summary
+	}
+
+	return summary + "\n" + r.output
+}
+
+// ToolResult returns one text content per statement followed by the whole
+// result as JSON. A failed transaction is returned as an error result.
+func (r *TxResult) ToolResult(err error) (*mcp.CallToolResult, error) {
+	data, jsonErr := json.Marshal(r)
+	if jsonErr != nil {
+		return nil, jsonErr
+	}
+
+	if err != nil {
+		result := ErrorResult(err)
+		result.Content = append(result.Content, mcp.NewTextContent(string(data)))
+		return result, nil
+	}
+
+	content := make([]mcp.Content, 0, len(r.Statements)+1)
+	for i := range r.Statements {
+		content = append(content, mcp.NewTextContent(r.Statements[i].Text()))
+	}
+	content = append(content, mcp.NewTextContent(string(data)))
+
+	return &mcp.CallToolResult{Content: content}, nil
+}
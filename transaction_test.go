@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseIsolationLevel(t *testing.T) {
+	name, level, err := ParseIsolationLevel(nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "read_committed", name)
+	assert.Equal(t, sql.LevelReadCommitted, level)
+
+	name, level, err = ParseIsolationLevel("Repeatable Read")
+	assert.NoError(t, err)
+	assert.Equal(t, "repeatable_read", name)
+	assert.Equal(t, sql.LevelRepeatableRead, level)
+
+	_, _, err = ParseIsolationLevel("read_uncommitted")
+	assert.Error(t, err)
+}
+
+func TestParseTxStatements(t *testing.T) {
+	t.Run("valid statements", func(t *testing.T) {
+		stmts, err := ParseTxStatements([]interface{}{
+			map[string]interface{}{"query": "UPDATE accounts SET balance = balance - $1 WHERE id = $2", "params": []interface{}{float64(10), float64(1)}},
+			map[string]interface{}{"query": "SELECT balance FROM accounts WHERE id = 1", "type": "select"},
+		})
+
+		assert.NoError(t, err)
+		assert.Len(t, stmts, 2)
+		assert.Equal(t, StatementTypeUpdate, stmts[0].Expect)
+		assert.Equal(t, []interface{}{int64(10), int64(1)}, stmts[0].Params)
+		assert.Equal(t, StatementTypeSelect, stmts[1].Expect)
+	})
+
+	t.Run("rejected statements", func(t *testing.T) {
+		for _, raw := range []interface{}{
+			nil,
+			[]interface{}{},
+			[]interface{}{"UPDATE accounts SET balance = 0"},
+			[]interface{}{map[string]interface{}{"query": ""}},
+			[]interface{}{map[string]interface{}{"query": "DROP TABLE accounts"}},
+			[]interface{}{map[string]interface{}{"query": "CREATE TABLE t (id int)"}},
+			[]interface{}{map[string]interface{}{"query": "DELETE FROM accounts", "type": "update"}},
+			[]interface{}{map[string]interface{}{"query": "SELECT 1", "type": "merge"}},
+		} {
+			_, err := ParseTxStatements(raw)
+			assert.Error(t, err, fmt.Sprint(raw))
+		}
+	})
+}
+
+func TestRunTransaction(t *testing.T) {
+	_, mock, cleanup := setupMockDB(t)
+	defer cleanup()
+
+	stmts := []TxStatement{
+		{Query: "UPDATE accounts SET balance = balance - 10 WHERE id = 1", Expect: StatementTypeUpdate},
+		{Query: "INSERT INTO transfers (account_id, amount) VALUES (1, 10) RETURNING id", Expect: StatementTypeInsert},
+		{Query: "SELECT balance FROM accounts WHERE id = 1", Expect: StatementTypeSelect},
+	}
+
+	t.Run("commit", func(t *testing.T) {
+		// Setup mock expectations
+		expectTx(mock)
+		mock.ExpectExec("UPDATE accounts").WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectQuery("INSERT INTO transfers").WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(7))
+		mock.ExpectQuery("SELECT balance").WillReturnRows(sqlmock.NewRows([]string{"balance"}).AddRow(90))
+		mock.ExpectCommit()
+
+		// Call RunTransaction
+		result, err := RunTransaction(context.Background(), stmts, "serializable", FormatCSV, 10)
+
+		// Verify results
+		assert.NoError(t, err)
+		assert.True(t, result.Committed)
+		assert.Equal(t, "serializable", result.IsolationLevel)
+		assert.Len(t, result.Statements, 3)
+		assert.Equal(t, "statement 1 (UPDATE): 1 rows affected", result.Statements[0].Text())
+		assert.Equal(t, "statement 2 (INSERT): 1 rows affected\nid\n7\n", result.Statements[1].Text())
+		assert.Equal(t, "statement 3 (SELECT): 1 rows\nbalance\n90\n", result.Statements[2].Text())
+		assert.NoError(t, mock.ExpectationsWereMet())
+
+		toolResult, err := result.ToolResult(nil)
+		assert.NoError(t, err)
+		assert.False(t, toolResult.IsError)
+		assert.Len(t, toolResult.Content, 4)
+	})
+
+	t.Run("rollback on failure", func(t *testing.T) {
+		// Setup mock expectations
+		expectTx(mock)
+		mock.ExpectExec("UPDATE accounts").WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectQuery("INSERT INTO transfers").WillReturnError(fmt.Errorf("violates foreign key constraint"))
+		mock.ExpectRollback()
+
+		// Call RunTransaction
+		result, err := RunTransaction(context.Background(), stmts, "", FormatCSV, 10)
+
+		// Verify results
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "statement 2 failed, transaction rolled back")
+		assert.False(t, result.Committed)
+		assert.Len(t, result.Statements, 2)
+		assert.Equal(t, "violates foreign key constraint", result.Statements[1].Error.Message)
+		assert.NoError(t, mock.ExpectationsWereMet())
+
+		toolResult, err := result.ToolResult(err)
+		assert.NoError(t, err)
+		assert.True(t, toolResult.IsError)
+
+		var data TxResult
+		assert.NoError(t, json.Unmarshal([]byte(toolResult.Content[len(toolResult.Content)-1].(mcp.TextContent).Text), &data))
+		assert.Equal(t, "read_committed", data.IsolationLevel)
+		assert.Len(t, data.Statements, 2)
+	})
+
+	t.Run("rollback on max affected rows", func(t *testing.T) {
+		MaxAffectedRows = 100
+		defer func() { MaxAffectedRows = 0 }()
+
+		// Setup mock expectations
+		expectTx(mock)
+		mock.ExpectExec("UPDATE accounts").WillReturnResult(sqlmock.NewResult(0, 250))
+		mock.ExpectRollback()
+
+		// Call RunTransaction
+		result, err := RunTransaction(context.Background(), stmts, "", FormatCSV, 10)
+
+		// Verify results
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "statement 1 failed, transaction rolled back: UPDATE would affect 250 rows")
+		assert.False(t, result.Committed)
+		assert.Equal(t, int64(250), result.Statements[0].Error.RowsAffected)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"strconv"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// BeginReadOnly starts a READ ONLY transaction with the per-call timeouts
+// applied, so that the database itself rejects writes the statement
+// classifier may have missed.
+func BeginReadOnly(ctx context.Context, db *sqlx.DB) (*sqlx.Tx, error) {
+	return BeginTx(ctx, db, &sql.TxOptions{ReadOnly: true})
+}
+
+// BeginTx starts a transaction with the per-call timeouts applied, so that
+// no statement of it can run or wait for locks without limit.
+func BeginTx(ctx context.Context, db *sqlx.DB, opts *sql.TxOptions) (*sqlx.Tx, error) {
+	return beginTx(ctx, db, opts, IdleInTransactionTimeout)
+}
+
+// beginTx is BeginTx with another idle timeout.
+func beginTx(ctx context.Context, db *sqlx.DB, opts *sql.TxOptions, idle time.Duration) (*sqlx.Tx, error) {
+	tx, err := db.BeginTxx(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := setLocalTimeouts(ctx, tx, idle); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	return tx, nil
+}
+
+// idleGrace is added to the idle_in_transaction_session_timeout of
+// transactions that stay open between tool calls, so that their local timer
+// closes them before the server terminates the connection.
+const idleGrace = 10 * time.Second
+
+// setLocalTimeouts applies statement_timeout, lock_timeout and the idle
+// timeout as idle_in_transaction_session_timeout to the current transaction
+// only. set_config(..., true) is the bind parameter friendly form of SET
+// LOCAL.
+func setLocalTimeouts(ctx context.Context, tx *sqlx.Tx, idle time.Duration) error {
+	_, err := tx.ExecContext(ctx, `SELECT set_config('statement_timeout', $1, true),
+       set_config('lock_timeout', $2, true),
+       set_config('idle_in_transaction_session_timeout', $3, true)`,
+		timeoutSetting(StatementTimeout), timeoutSetting(LockTimeout), timeoutSetting(idle))
+
+	return err
+}
+
+// timeoutSetting formats d in milliseconds, 0 disables the timeout.
+func timeoutSetting(d time.Duration) string {
+	return strconv.FormatInt(d.Milliseconds(), 10)
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBeginReadOnly(t *testing.T) {
+	_, mock, cleanup := setupMockDB(t)
+	defer cleanup()
+
+	// Save original timeouts
+	originalTimeouts := []time.Duration{StatementTimeout, LockTimeout, IdleInTransactionTimeout}
+	defer func() {
+		StatementTimeout, LockTimeout, IdleInTransactionTimeout = originalTimeouts[0], originalTimeouts[1], originalTimeouts[2]
+	}()
+
+	StatementTimeout = 30 * time.Second
+	LockTimeout = 5 * time.Second
+	IdleInTransactionTimeout = 0
+
+	t.Run("applies timeouts to the transaction", func(t *testing.T) {
+		// Setup mock expectations
+		mock.ExpectBegin()
+		mock.ExpectExec("set_config").
+			WithArgs("30000", "5000", "0").
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectRollback()
+
+		// Call BeginReadOnly
+		tx, err := BeginReadOnly(context.Background(), DB)
+
+		// Verify results
+		assert.NoError(t, err)
+		assert.NoError(t, tx.Rollback())
+	})
+
+	t.Run("rolls back when the timeouts cannot be set", func(t *testing.T) {
+		// Setup mock expectations
+		mock.ExpectBegin()
+		mock.ExpectExec("set_config").WillReturnError(fmt.Errorf("set_config error"))
+		mock.ExpectRollback()
+
+		// Call BeginReadOnly
+		_, err := BeginReadOnly(context.Background(), DB)
+
+		// Verify results
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "set_config error")
+	})
+
+	t.Run("begin error", func(t *testing.T) {
+		// Setup mock expectations
+		mock.ExpectBegin().WillReturnError(fmt.Errorf("begin error"))
+
+		// Call BeginReadOnly
+		_, err := BeginReadOnly(context.Background(), DB)
+
+		// Verify results
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "begin error")
+	})
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,323 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// Column describes a result column.
+type Column struct {
+	Name string `json:"name"`
+	// Type is the Postgres type name, arrays are prefixed with an
+	// underscore (e.g. _int4). It is empty for types the driver does not
+	// know, such as enums.
+	Type string `json:"type"`
+	// TypeOID is 0 when the type cannot be told from the result.
+	TypeOID uint32 `json:"type_oid,omitempty"`
+	// Nullable is nil when it cannot be told from the result.
+	Nullable *bool `json:"nullable"`
+}
+
+// typeOIDs are the OIDs of the built-in types, they are fixed across
+// Postgres versions.
+var typeOIDs = map[string]uint32{
+	"bool": 16, "bytea": 17, "char": 18, "name": 19, "int8": 20, "int2": 21,
+	"int4": 23, "regproc": 24, "text": 25, "oid": 26, "tid": 27, "xid": 28,
+	"cid": 29, "json": 114, "xml": 142, "point": 600, "cidr": 650,
+	"float4": 700, "float8": 701, "unknown": 705, "circle": 718,
+	"money": 790, "macaddr": 829, "inet": 869, "bpchar": 1042,
+	"varchar": 1043, "date": 1082, "time": 1083, "timestamp": 1114,
+	"timestamptz": 1184, "interval": 1186, "timetz": 1266, "bit": 1560,
+	"varbit": 1562, "numeric": 1700, "regclass": 2205, "regtype": 2206,
+	"record": 2249, "void": 2278, "uuid": 2950, "tsvector": 3614,
+	"tsquery": 3615, "jsonb": 3802, "int4range": 3904, "numrange": 3906,
+	"tsrange": 3908, "tstzrange": 3910, "daterange": 3912,
+	"int8range": 3926, "jsonpath": 4072,
+
+	"_xml": 143, "_json": 199, "_cidr": 651, "_money": 791,
+	"_bool": 1000, "_bytea": 1001, "_char": 1002, "_name": 1003,
+	"_int2": 1005, "_int4": 1007, "_text": 1009, "_bpchar": 1014,
+	"_varchar": 1015, "_int8": 1016, "_point": 1017, "_float4": 1021,
+	"_float8": 1022, "_oid": 1028, "_macaddr": 1040, "_inet": 1041,
+	"_timestamp": 1115, "_date": 1182, "_time": 1183,
+	"_timestamptz": 1185, "_interval": 1187, "_numeric": 1231,
+	"_timetz": 1270, "_uuid": 2951, "_jsonb": 3807,
+}
+
+// ResultColumns returns the columns of rows.
+func ResultColumns(rows *sqlx.Rows) ([]Column, error) {
+	types, err := rows.ColumnTypes()
+	if err != nil {
+		return nil, err
+	}
+
+	return columnsOf(types), nil
+}
+
+func columnsOf(types []*sql.ColumnType) []Column {
+	cols := make([]Column, len(types))
+	for i, t := range types {
+		typ := strings.ToLower(t.DatabaseTypeName())
+		cols[i] = Column{Name: t.Name(), Type: typ, TypeOID: typeOIDs[typ]}
+		if oid, err := strconv.ParseUint(typ, 10, 32); err == nil {
+			// pgx names the types it does not know by their OID
+			cols[i].Type, cols[i].TypeOID = "", uint32(oid)
+		}
+		if nullable, ok := t.Nullable(); ok {
+			cols[i].Nullable = &nullable
+		}
+	}
+
+	return cols
+}
+
+// ColumnNames returns the names of cols.
+func ColumnNames(cols []Column) []string {
+	names := make([]string, len(cols))
+	for i, col := range cols {
+		names[i] = col.Name
+	}
+
+	return names
+}
+
+// TextValue renders v the way Postgres prints it, ok is false for NULL.
+func TextValue(col Column, v interface{}) (string, bool) {
+	switch v := v.(type) {
+	case nil:
+		return "", false
+	case []byte:
+		if col.Type == "bytea" {
+			return byteaText(v), true
+		}
+		return string(v), true
+	case string:
+		if col.Type == "bytea" {
+			return byteaText([]byte(v)), true
+		}
+		return v, true
+	case time.Time:
+		return timeText(col, v), true
+	case float64:
+		return floatText(v), true
+	case float32:
+		return floatText(float64(v)), true
+	case int64:
+		return strconv.FormatInt(v, 10), true
+	case bool:
+		return strconv.FormatBool(v), true
+	default:
+		return fmt.Sprint(v), true
+	}
+}
+
+// JSONValue converts v to the value written by the json and ndjson formats.
+// jsonb stays a JSON document, numerics keep their precision and arrays
+// become JSON arrays.
+func JSONValue(col Column, v interface{}) interface{} {
+	switch v := v.(type) {
+	case nil:
+		return nil
+	case time.Time:
+		switch col.Type {
+		case "date":
+			return v.Format("2006-01-02")
+		case "timestamp":
+			return v.Format("2006-01-02T15:04:05.999999")
+		default:
+			return v.Format(time.RFC3339Nano)
+		}
+	case float64:
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			return floatText(v)
+		}
+		return v
+	case float32:
+		return JSONValue(col, float64(v))
+	case []byte:
+		if col.Type == "bytea" {
+			return byteaText(v)
+		}
+		return JSONValue(col, string(v))
+	case string:
+		if strings.HasPrefix(col.Type, "_") {
+			if elems, err := parseArray(v); err == nil {
+				return arrayJSON(col.Type[1:], elems)
+			}
+			return v
+		}
+		return textJSON(col.Type, v)
+	default:
+		return v
+	}
+}
+
+// textJSON converts the text form of a value of type typ.
+func textJSON(typ, s string) interface{} {
+	switch typ {
+	case "json", "jsonb":
+		if json.Valid([]byte(s)) {
+			return json.RawMessage(s)
+		}
+	case "int2", "int4", "int8", "oid", "float4", "float8", "numeric":
+		if isJSONNumber(s) {
+			return json.Number(s)
+		}
+	case "bool":
+		switch s {
+		case "t", "true":
+			return true
+		case "f", "false":
+			return false
+		}
+	case "bytea":
+		return byteaText([]byte(s))
+	}
+
+	return s
+}
+
+func arrayJSON(typ string, elems []interface{}) []interface{} {
+	out := make([]interface{}, len(elems))
+	for i, elem := range elems {
+		switch elem := elem.(type) {
+		case []interface{}:
+			out[i] = arrayJSON(typ, elem)
+		case string:
+			if typ == "bytea" {
+				// bytea array elements are already in hex form
+				out[i] = elem
+			} else {
+				out[i] = textJSON(typ, elem)
+			}
+		}
+	}
+
+	return out
+}
+
+func isJSONNumber(s string) bool {
+	var n json.Number
+	return json.Unmarshal([]byte(s), &n) == nil
+}
+
+func byteaText(b []byte) string {
+	return `\x` + hex.EncodeToString(b)
+}
+
+func timeText(col Column, t time.Time) string {
+	switch col.Type {
+	case "date":
+		return t.Format("2006-01-02")
+	case "timestamp":
+		return t.Format("2006-01-02 15:04:05.999999")
+	default:
+		return t.Format("2006-01-02 15:04:05.999999-07:00")
+	}
+}
+
+func floatText(f float64) string {
+	switch {
+	case math.IsNaN(f):
+		return "NaN"
+	case math.IsInf(f, 1):
+		return "Infinity"
+	case math.IsInf(f, -1):
+		return "-Infinity"
+	case math.Abs(f) >= 1e21:
+		return strconv.FormatFloat(f, 'g', -1, 64)
+	default:
+		return strconv.FormatFloat(f, 'f', -1, 64)
+	}
+}
+
+// parseArray parses the text form of a Postgres array. Elements are strings,
+// nil for NULL, or nested slices for multidimensional arrays.
+func parseArray(s string) ([]interface{}, error) {
+	// skip the dimension decoration of arrays not starting at 1, e.g. [0:1]={a,b}
+	if strings.HasPrefix(s, "[") {
+		i := strings.Index(s, "=")
+		if i < 0 {
+			return nil, fmt.Errorf("invalid array %q", s)
+		}
+		s = s[i+1:]
+	}
+
+	elems, rest, err := parseArrayLevel(s)
+	if err != nil {
+		return nil, err
+	}
+	if rest != "" {
+		return nil, fmt.Errorf("invalid array %q", s)
+	}
+
+	return elems, nil
+}
+
+func parseArrayLevel(s string) ([]interface{}, string, error) {
+	if !strings.HasPrefix(s, "{") {
+		return nil, "", fmt.Errorf("invalid array %q", s)
+	}
+	s = s[1:]
+
+	elems := []interface{}{}
+	if strings.HasPrefix(s, "}") {
+		return elems, s[1:], nil
+	}
+
+	for {
+		switch {
+		case strings.HasPrefix(s, "{"):
+			sub, rest, err := parseArrayLevel(s)
+			if err != nil {
+				return nil, "", err
+			}
+			elems = append(elems, sub)
+			s = rest
+		case strings.HasPrefix(s, `"`):
+			var b strings.Builder
+			i := 1
+			for ; i < len(s) && s[i] != '"'; i++ {
+				if s[i] == '\\' && i+1 < len(s) {
+					i++
+				}
+				b.WriteByte(s[i])
+			}
+			if i >= len(s) {
+				return nil, "", fmt.Errorf("unterminated array element")
+			}
+			elems = append(elems, b.String())
+			s = s[i+1:]
+		default:
+			i := strings.IndexAny(s, ",}")
+			if i < 0 {
+				return nil, "", fmt.Errorf("unterminated array")
+			}
+			if elem := strings.TrimSpace(s[:i]); elem == "NULL" {
+				elems = append(elems, nil)
+			} else {
+				elems = append(elems, elem)
+			}
+			s = s[i:]
+		}
+
+		if s == "" {
+			return nil, "", fmt.Errorf("unterminated array")
+		}
+		if s[0] == '}' {
+			return elems, s[1:], nil
+		}
+		if s[0] != ',' {
+			return nil, "", fmt.Errorf("unexpected %q in array", s[0])
+		}
+		s = s[1:]
+	}
+}
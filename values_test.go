@@ -0,0 +1,100 @@
+package main
+
+import (
+	"encoding/json"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResultColumns(t *testing.T) {
+	_, mock, cleanup := setupMockDB(t)
+	defer cleanup()
+
+	// Setup mock expectations
+	mock.ExpectQuery("SELECT id, mood").WillReturnRows(mock.NewRowsWithColumnDefinition(
+		sqlmock.NewColumn("id").OfType("INT8", int64(0)).Nullable(false),
+		sqlmock.NewColumn("mood").OfType("16385", ""),
+	))
+
+	// Call ResultColumns
+	rows, err := DB.Queryx("SELECT id, mood FROM people")
+	assert.NoError(t, err)
+	defer rows.Close()
+	cols, err := ResultColumns(rows)
+
+	// Verify results
+	assert.NoError(t, err)
+	notNull := false
+	assert.Equal(t, []Column{
+		{Name: "id", Type: "int8", TypeOID: 20, Nullable: &notNull},
+		{Name: "mood", TypeOID: 16385},
+	}, cols)
+}
+
+func TestTextValue(t *testing.T) {
+	ts := time.Date(2024, 1, 2, 3, 4, 5, 600000000, time.FixedZone("", 8*3600))
+
+	cases := []struct {
+		name  string
+		col   Column
+		value interface{}
+		want  string
+	}{
+		{"bytea", Column{Type: "bytea"}, []byte{0xde, 0xad}, `\xdead`},
+		{"bytea scanned as text", Column{Type: "bytea"}, "\x01\x02", `\x0102`},
+		{"timestamptz", Column{Type: "timestamptz"}, ts, "2024-01-02 03:04:05.6+08:00"},
+		{"timestamp", Column{Type: "timestamp"}, ts, "2024-01-02 03:04:05.6"},
+		{"date", Column{Type: "date"}, ts, "2024-01-02"},
+		{"float", Column{Type: "float8"}, 1234567.25, "1234567.25"},
+		{"infinity", Column{Type: "float8"}, math.Inf(1), "Infinity"},
+		{"bool", Column{Type: "bool"}, true, "true"},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got, ok := TextValue(c.col, c.value)
+
+			assert.True(t, ok)
+			assert.Equal(t, c.want, got)
+		})
+	}
+
+	t.Run("null", func(t *testing.T) {
+		_, ok := TextValue(Column{Type: "text"}, nil)
+
+		assert.False(t, ok)
+	})
+}
+
+func TestJSONValue(t *testing.T) {
+	cases := []struct {
+		name  string
+		col   Column
+		value interface{}
+		want  string
+	}{
+		{"numeric keeps precision", Column{Type: "numeric"}, "12345678901234567890.01", `12345678901234567890.01`},
+		{"numeric NaN", Column{Type: "numeric"}, "NaN", `"NaN"`},
+		{"jsonb", Column{Type: "jsonb"}, `{"a": null}`, `{"a":null}`},
+		{"bytea", Column{Type: "bytea"}, []byte("hi"), `"\\x6869"`},
+		{"int array", Column{Type: "_int4"}, "{{1,2},{3,NULL}}", `[[1,2],[3,null]]`},
+		{"bool array", Column{Type: "_bool"}, "{t,f}", `[true,false]`},
+		{"array with bounds", Column{Type: "_text"}, `[0:1]={"a\"b","c\\d"}`, `["a\"b","c\\d"]`},
+		{"timestamp", Column{Type: "timestamp"}, time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC), `"2024-01-02T03:04:05"`},
+		{"float NaN", Column{Type: "float8"}, math.NaN(), `"NaN"`},
+		{"null", Column{Type: "text"}, nil, `null`},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			data, err := json.Marshal(JSONValue(c.col, c.value))
+
+			assert.NoError(t, err)
+			assert.Equal(t, c.want, string(data))
+		})
+	}
+}